@@ -35,10 +35,21 @@ type Config struct {
 
 	// Returns whether lhs is less than rhs.
 	Less func(lhs, rhs []byte) bool
+
+	// Returns whether rec begins with prefix, for PrefixRange. If nil,
+	// records are compared bytewise.
+	Prefix func(rec, prefix []byte) bool
+
+	// An optional index of the file, used to narrow LowerBound searches.
+	Index *Index
 }
 
-// Read reads a record at the given position.
+// Read reads a record at the given position. If r is a Slicer, the record's
+// data is not copied.
 func Read(c Config, r Reader, pos int64) Record {
+	if s, ok := r.(Slicer); ok {
+		return readSlice(c, s.Bytes(), pos)
+	}
 	var (
 		res      Record
 		first    []byte = make([]byte, c.ChunkSize)
@@ -144,6 +155,13 @@ func LowerBound(c Config, r Reader, end int64, value []byte) Record {
 		last  Record
 		start int64 = 0
 	)
+	if c.Index != nil && len(c.Index.records) > 0 {
+		last, end = c.Index.narrow(c, value, end)
+		start = last.End
+		if start >= end {
+			return last
+		}
+	}
 	for {
 		var (
 			width = (end - start)
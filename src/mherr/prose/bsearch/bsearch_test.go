@@ -7,6 +7,25 @@ import (
 	"testing"
 )
 
+// sliceReader is a Slicer of a byte slice, like a memory-mapped file.
+type sliceReader struct {
+	*bytes.Reader
+	data []byte
+}
+
+func (r sliceReader) Bytes() []byte {
+	return r.data
+}
+
+// readers returns a Reader of data of each kind, by name.
+func readers(data string) map[string]Reader {
+	b := []byte(data)
+	return map[string]Reader{
+		"file":  bytes.NewReader(b),
+		"slice": sliceReader{bytes.NewReader(b), b},
+	}
+}
+
 func TestRead(t *testing.T) {
 	tests := []struct {
 		desc string
@@ -67,10 +86,11 @@ func TestRead(t *testing.T) {
 	}
 
 	for _, c := range tests {
-		r := bytes.NewReader([]byte(c.data))
-		data := Read(cfg, r, c.pos)
-		if !reflect.DeepEqual(data, c.want) {
-			t.Fatalf("test(%v): bad result: %v", c.desc, data)
+		for name, r := range readers(c.data) {
+			data := Read(cfg, r, c.pos)
+			if !reflect.DeepEqual(data, c.want) {
+				t.Fatalf("test(%v) with %v: bad result: %v", c.desc, name, data)
+			}
 		}
 	}
 }
@@ -120,10 +140,11 @@ func TestLowerBound(t *testing.T) {
 	}
 
 	for _, c := range tests {
-		r := bytes.NewReader([]byte(c.data))
-		data := LowerBound(cfg, r, int64(len(c.data)), []byte(c.req))
-		if !reflect.DeepEqual(data, c.want) {
-			t.Fatalf("test(%v): bad result: %v", c.desc, data)
+		for name, r := range readers(c.data) {
+			data := LowerBound(cfg, r, int64(len(c.data)), []byte(c.req))
+			if !reflect.DeepEqual(data, c.want) {
+				t.Fatalf("test(%v) with %v: bad result: %v", c.desc, name, data)
+			}
 		}
 	}
 }
@@ -173,10 +194,11 @@ func TestUpperBound(t *testing.T) {
 	}
 
 	for _, c := range tests {
-		r := bytes.NewReader([]byte(c.data))
-		data := UpperBound(cfg, r, int64(len(c.data)), []byte(c.req))
-		if !reflect.DeepEqual(data, c.want) {
-			t.Fatalf("test(%v): bad result: %v", c.desc, data)
+		for name, r := range readers(c.data) {
+			data := UpperBound(cfg, r, int64(len(c.data)), []byte(c.req))
+			if !reflect.DeepEqual(data, c.want) {
+				t.Fatalf("test(%v) with %v: bad result: %v", c.desc, name, data)
+			}
 		}
 	}
 }
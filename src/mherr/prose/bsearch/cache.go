@@ -0,0 +1,129 @@
+package bsearch
+
+import (
+	"container/list"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// BlockCache is an LRU cache of fixed-size, aligned blocks of files. One cache
+// may be shared by the Readers of many files.
+type BlockCache struct {
+	blockSize int64
+	blocks    int
+
+	// Counters for Stats.
+	hits, misses int64
+
+	mu      sync.Mutex
+	nextID  int
+	entries map[blockKey]*list.Element
+	lru     *list.List
+}
+
+type blockKey struct {
+	// The Reader which the block belongs to.
+	id int
+	// The block's position in its file, in blocks.
+	index int64
+}
+
+type block struct {
+	key  blockKey
+	data []byte
+}
+
+// NewBlockCache returns a cache of up to blocks blocks of blockSize bytes.
+// The block size should usually be the ChunkSize of the Config used to read
+// through the cache.
+func NewBlockCache(blockSize, blocks int) *BlockCache {
+	return &BlockCache{
+		blockSize: int64(blockSize),
+		blocks:    blocks,
+		entries:   make(map[blockKey]*list.Element),
+		lru:       list.New(),
+	}
+}
+
+// Reader returns a Reader which reads from r, a file of the given size,
+// through the cache. The file must not change while the Reader is in use.
+func (c *BlockCache) Reader(r io.ReaderAt, size int64) Reader {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	return &cachedReader{c, c.nextID, r, size}
+}
+
+// Stats returns the number of blocks which were found in the cache, and the
+// number which had to be read.
+func (c *BlockCache) Stats() (hits, misses int64) {
+	return atomic.LoadInt64(&c.hits), atomic.LoadInt64(&c.misses)
+}
+
+// get returns the block at index from the cache, or reads it with r.
+func (c *BlockCache) get(r *cachedReader, index int64) ([]byte, error) {
+	key := blockKey{r.id, index}
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(e)
+		c.mu.Unlock()
+		atomic.AddInt64(&c.hits, 1)
+		return e.Value.(*block).data, nil
+	}
+	c.mu.Unlock()
+	atomic.AddInt64(&c.misses, 1)
+
+	off := index * c.blockSize
+	size := c.blockSize
+	if off+size > r.size {
+		size = r.size - off
+	}
+	data := make([]byte, size)
+	if _, err := r.r.ReadAt(data, off); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.lru.PushFront(&block{key, data})
+		if c.lru.Len() > c.blocks {
+			last := c.lru.Back()
+			c.lru.Remove(last)
+			delete(c.entries, last.Value.(*block).key)
+		}
+	}
+	return data, nil
+}
+
+// cachedReader reads a file through a BlockCache.
+type cachedReader struct {
+	c    *BlockCache
+	id   int
+	r    io.ReaderAt
+	size int64
+}
+
+// ReadAt implements Reader.
+func (r *cachedReader) ReadAt(b []byte, off int64) (int, error) {
+	n := 0
+	for n < len(b) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+		bs := r.c.blockSize
+		data, err := r.c.get(r, off/bs)
+		if err != nil {
+			return n, err
+		}
+		if off%bs >= int64(len(data)) {
+			// The file was shorter than expected.
+			return n, io.EOF
+		}
+		c := copy(b[n:], data[off%bs:])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
@@ -0,0 +1,62 @@
+package bsearch
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestBlockCache(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	c := NewBlockCache(4, 2)
+	r := c.Reader(bytes.NewReader(data), int64(len(data)))
+
+	tests := []struct {
+		off     int64
+		size    int
+		want    string
+		wantErr error
+	}{
+		{0, 4, "0123", nil},
+		{2, 5, "23456", nil},
+		{18, 2, "ij", nil},
+		{18, 4, "ij", io.EOF},
+		{20, 1, "", io.EOF},
+	}
+	for _, tc := range tests {
+		b := make([]byte, tc.size)
+		n, err := r.ReadAt(b, tc.off)
+		if got := string(b[:n]); got != tc.want || err != tc.wantErr {
+			t.Errorf("ReadAt(%v, %v): got %q, %v; want %q, %v", tc.size, tc.off, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestBlockCacheStats(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	c := NewBlockCache(4, 2)
+	r := c.Reader(bytes.NewReader(data), int64(len(data)))
+	b := make([]byte, 4)
+
+	// The first read misses, the second hits.
+	r.ReadAt(b, 0)
+	r.ReadAt(b, 0)
+	if hits, misses := c.Stats(); hits != 1 || misses != 1 {
+		t.Fatalf("got %v hits and %v misses, want 1 and 1", hits, misses)
+	}
+
+	// Reading two more blocks evicts the first.
+	r.ReadAt(b, 4)
+	r.ReadAt(b, 8)
+	r.ReadAt(b, 0)
+	if hits, misses := c.Stats(); hits != 1 || misses != 4 {
+		t.Fatalf("got %v hits and %v misses, want 1 and 4", hits, misses)
+	}
+
+	// Other readers do not share blocks.
+	other := c.Reader(bytes.NewReader([]byte("ABCD")), 4)
+	other.ReadAt(b, 0)
+	if string(b) != "ABCD" {
+		t.Fatalf("read %q from another reader", b)
+	}
+}
@@ -0,0 +1,199 @@
+package bsearch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// indexMagic begins every index file.
+const indexMagic = "bsearch-index-1\n"
+
+// ErrStale is returned when an index does not match its data file.
+var ErrStale = errors.New("bsearch: index is stale")
+
+// Index is a sparse, in-memory index of a delimited file: the offset and
+// contents of every Kth record. Setting Config.Index narrows a search to the
+// records between two entries, saving most of the reads of a full search.
+type Index struct {
+	// The size and modification time, in Unix nanoseconds, of the file
+	// when it was indexed.
+	Size    int64
+	ModTime int64
+
+	offsets []int64
+	records [][]byte
+}
+
+// IndexName returns the name of the index file for a data file.
+func IndexName(filename string) string {
+	return filename + ".idx"
+}
+
+// BuildIndex indexes every Kth record of the file read from r.
+func BuildIndex(c Config, r io.Reader, every int) (*Index, error) {
+	if every < 1 {
+		return nil, fmt.Errorf("bsearch: cannot index every %v records", every)
+	}
+	var (
+		ix  = &Index{}
+		br  = bufio.NewReader(r)
+		off int64
+	)
+	for n := 0; ; n++ {
+		rec, err := br.ReadBytes(c.Delimiter)
+		if err == io.EOF {
+			// A final record without a delimiter cannot be read, so is not indexed.
+			return ix, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n%every == 0 {
+			ix.offsets = append(ix.offsets, off)
+			ix.records = append(ix.records, rec)
+		}
+		off += int64(len(rec))
+	}
+}
+
+// WriteTo writes the index in the format read by ReadIndex.
+func (ix *Index) WriteTo(w io.Writer) (int64, error) {
+	var (
+		buf bytes.Buffer
+		tmp [binary.MaxVarintLen64]byte
+		put = func(v int64) {
+			buf.Write(tmp[:binary.PutVarint(tmp[:], v)])
+		}
+	)
+	buf.WriteString(indexMagic)
+	put(ix.Size)
+	put(ix.ModTime)
+	put(int64(len(ix.offsets)))
+	for i, off := range ix.offsets {
+		put(off)
+		put(int64(len(ix.records[i])))
+		buf.Write(ix.records[i])
+	}
+	return buf.WriteTo(w)
+}
+
+// ReadIndex reads an index written by WriteTo.
+func ReadIndex(r io.Reader) (*Index, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(indexMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != indexMagic {
+		return nil, errors.New("bsearch: not an index file")
+	}
+	var (
+		err error
+		get = func() int64 {
+			if err != nil {
+				return 0
+			}
+			var v int64
+			v, err = binary.ReadVarint(br)
+			return v
+		}
+		ix = &Index{Size: get(), ModTime: get()}
+		n  = get()
+	)
+	for i := int64(0); i < n && err == nil; i++ {
+		off, l := get(), get()
+		if err != nil {
+			break
+		}
+		rec := make([]byte, l)
+		if _, err = io.ReadFull(br, rec); err != nil {
+			break
+		}
+		ix.offsets = append(ix.offsets, off)
+		ix.records = append(ix.records, rec)
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bsearch: reading index: %v", err)
+	}
+	return ix, nil
+}
+
+// LoadIndex reads the index of the data file filename, whose current state is
+// st. It returns ErrStale if the data file has changed since it was indexed.
+func LoadIndex(filename string, st os.FileInfo) (*Index, error) {
+	f, err := os.Open(IndexName(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ix, err := ReadIndex(f)
+	if err != nil {
+		return nil, err
+	}
+	if ix.Size != st.Size() || ix.ModTime != st.ModTime().UnixNano() {
+		return nil, ErrStale
+	}
+	return ix, nil
+}
+
+// WriteIndex indexes every Kth record of the data file filename, and writes
+// the index alongside it.
+func WriteIndex(c Config, filename string, every int) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	ix, err := BuildIndex(c, f, every)
+	if err != nil {
+		return err
+	}
+	ix.Size, ix.ModTime = st.Size(), st.ModTime().UnixNano()
+
+	tmp := IndexName(filename) + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := ix.WriteTo(out); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, IndexName(filename))
+}
+
+// narrow returns the last indexed record less than value, if any, and the
+// offset of the indexed record after it.
+func (ix *Index) narrow(c Config, value []byte, end int64) (Record, int64) {
+	// Find the first indexed record not less than value.
+	lo, hi := 0, len(ix.records)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if c.Less(ix.records[mid], value) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo < len(ix.offsets) {
+		end = ix.offsets[lo]
+	}
+	if lo == 0 {
+		return Record{}, end
+	}
+	off := ix.offsets[lo-1]
+	data := ix.records[lo-1]
+	return Record{Start: off, End: off + int64(len(data)), Data: data}, end
+}
@@ -0,0 +1,98 @@
+package bsearch
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// countingReader counts the calls to ReadAt.
+type countingReader struct {
+	*bytes.Reader
+	reads int
+}
+
+func (r *countingReader) ReadAt(b []byte, off int64) (int, error) {
+	r.reads++
+	return r.Reader.ReadAt(b, off)
+}
+
+func TestIndexedLowerBound(t *testing.T) {
+	data := "01.02.03.04.05.06.07.08.09.10."
+	cfg := Config{
+		ChunkSize: 4,
+		Delimiter: '.',
+		Less: func(l, r []byte) bool {
+			return string(l) < string(r)
+		},
+	}
+	for every := 1; every <= 4; every++ {
+		ix, err := BuildIndex(cfg, bytes.NewReader([]byte(data)), every)
+		if err != nil {
+			t.Fatal(err)
+		}
+		indexed := cfg
+		indexed.Index = ix
+		for _, req := range []string{"", "01.", "01x.", "04.", "05x.", "09x.", "10.", "10x.", "11."} {
+			plain := &countingReader{Reader: bytes.NewReader([]byte(data))}
+			want := LowerBound(cfg, plain, int64(len(data)), []byte(req))
+			r := &countingReader{Reader: bytes.NewReader([]byte(data))}
+			got := LowerBound(indexed, r, int64(len(data)), []byte(req))
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("every %v, LowerBound(%q): got %v, want %v", every, req, got, want)
+			}
+			if r.reads > plain.reads {
+				t.Fatalf("every %v, LowerBound(%q): %v reads with the index, %v without", every, req, r.reads, plain.reads)
+			}
+		}
+	}
+}
+
+func TestIndexFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "Index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := dir + "/data"
+	if err := ioutil.WriteFile(filename, []byte("a\nb\nc\nd\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{ChunkSize: 4, Delimiter: '\n'}
+	if err := WriteIndex(cfg, filename, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := LoadIndex(filename, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Index{
+		Size:    8,
+		ModTime: st.ModTime().UnixNano(),
+		offsets: []int64{0, 4},
+		records: [][]byte{[]byte("a\n"), []byte("c\n")},
+	}
+	if !reflect.DeepEqual(ix, want) {
+		t.Fatalf("got %+v, want %+v", ix, want)
+	}
+
+	// Changing the data file makes the index stale.
+	later := st.ModTime().Add(time.Second)
+	if err := os.Chtimes(filename, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if st, err = os.Stat(filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIndex(filename, st); err != ErrStale {
+		t.Fatalf("got %v, want %v", err, ErrStale)
+	}
+}
@@ -0,0 +1,82 @@
+package bsearch
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrMmapUnsupported is returned by Mmap where files cannot be memory-mapped.
+var ErrMmapUnsupported = errors.New("bsearch: mmap is not supported")
+
+// Slicer is a Reader whose contents can be read without copying, such as a
+// memory-mapped file. Read uses a faster path for Slicers.
+type Slicer interface {
+	Reader
+	// Bytes returns the whole contents, which must not be modified.
+	Bytes() []byte
+}
+
+// Mapped is a read-only memory-mapped file.
+type Mapped struct {
+	data []byte
+}
+
+// Mmap maps the first size bytes of f into memory, failing if f is not that
+// long. The file may be closed once it is mapped, but must not be truncated.
+// It returns ErrMmapUnsupported on systems which do not support it.
+func Mmap(f *os.File, size int64) (*Mapped, error) {
+	if size == 0 {
+		return &Mapped{}, nil
+	}
+	data, err := mmap(f, size)
+	if err != nil {
+		return nil, err
+	}
+	return &Mapped{data}, nil
+}
+
+// Bytes implements Slicer.
+func (m *Mapped) Bytes() []byte {
+	return m.data
+}
+
+// ReadAt implements Reader.
+func (m *Mapped) ReadAt(b []byte, off int64) (int, error) {
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, m.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Close unmaps the file. Slices returned by Bytes, or in the Records read
+// from it, must not be used afterwards.
+func (m *Mapped) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data = nil
+	return munmap(data)
+}
+
+// readSlice is Read for a Slicer. The record's data is part of the Slicer's
+// contents.
+func readSlice(c Config, data []byte, pos int64) Record {
+	if pos >= int64(len(data)) {
+		return Record{Start: pos, End: pos, Err: io.EOF}
+	}
+	start := int64(bytes.LastIndexByte(data[:pos], c.Delimiter) + 1)
+	i := bytes.IndexByte(data[pos:], c.Delimiter)
+	if i < 0 {
+		// Like Read, return the part of the record before pos.
+		return Record{Start: start, End: pos, Data: data[start:pos], Err: io.EOF}
+	}
+	end := pos + int64(i) + 1
+	return Record{Start: start, End: end, Data: data[start:end]}
+}
@@ -0,0 +1,28 @@
+package bsearch
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmap maps the first size bytes of f privately and read-only. Mapping
+// beyond the end of the file would fault when read, so size must be within
+// both the file's current size and the range of an int.
+func mmap(f *os.File, size int64) ([]byte, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 || size > st.Size() {
+		return nil, fmt.Errorf("bsearch: cannot map %v bytes of %v, which has %v", size, f.Name(), st.Size())
+	}
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("bsearch: %v is too large to map", f.Name())
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_PRIVATE)
+}
+
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
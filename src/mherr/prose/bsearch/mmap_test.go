@@ -0,0 +1,96 @@
+package bsearch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+var benchConfig = Config{
+	ChunkSize: 1024,
+	Delimiter: '\n',
+	Less: func(l, r []byte) bool {
+		return string(l) < string(r)
+	},
+}
+
+// tempRecords writes a file of n sorted records, returning it open.
+func tempRecords(t testing.TB, n int) *os.File {
+	f, err := ioutil.TempFile("", "Mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(f, "record %08d\n", i)
+	}
+	return f
+}
+
+func TestMmap(t *testing.T) {
+	f := tempRecords(t, 1000)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Mmap(f, st.Size())
+	if err == ErrMmapUnsupported {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	for _, req := range []string{"", "record 00000000\n", "record 00000500x", "record 00000999\n", "z"} {
+		want := LowerBound(benchConfig, f, st.Size(), []byte(req))
+		got := LowerBound(benchConfig, m, st.Size(), []byte(req))
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("LowerBound(%q): got %v, want %v", req, got, want)
+		}
+	}
+
+	b := make([]byte, 7)
+	if n, err := m.ReadAt(b, 16); n != 7 || err != nil || string(b) != "record " {
+		t.Fatalf("ReadAt: got %v, %v, %q", n, err, b)
+	}
+
+	// Only what is in the file can be mapped.
+	if m, err := Mmap(f, st.Size()+1); err == nil {
+		m.Close()
+		t.Fatal("mapped past the end of the file")
+	}
+}
+
+func BenchmarkLowerBound(b *testing.B) {
+	f := tempRecords(b, 100000)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		b.Fatal(err)
+	}
+	readers := map[string]Reader{"file": f}
+	if m, err := Mmap(f, st.Size()); err == nil {
+		defer m.Close()
+		readers["mmap"] = m
+	}
+
+	for _, name := range []string{"file", "mmap"} {
+		r, ok := readers[name]
+		b.Run(name, func(b *testing.B) {
+			if !ok {
+				b.Skip(ErrMmapUnsupported)
+			}
+			for i := 0; i < b.N; i++ {
+				req := fmt.Sprintf("record %08d\n", i*7919%100000)
+				if res := LowerBound(benchConfig, r, st.Size(), []byte(req)); res.Err != nil {
+					b.Fatal(res.Err)
+				}
+			}
+		})
+	}
+}
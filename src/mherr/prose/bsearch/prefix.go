@@ -0,0 +1,140 @@
+package bsearch
+
+import (
+	"bytes"
+	"io"
+)
+
+// minBuffer is the least amount of data read at once by an Iterator.
+const minBuffer = 4096
+
+// Iterator iterates over the consecutive records of a file which begin with a
+// prefix. It reads the file sequentially, in large buffered reads.
+type Iterator struct {
+	c      Config
+	r      Reader
+	size   int64
+	prefix []byte
+	// The most records to return, or 0 for no limit.
+	max int
+	n   int
+
+	// The offset of the next record.
+	off int64
+	// Data read from the file at bufOff, and whether it reaches the end.
+	buf    []byte
+	bufOff int64
+	eof    bool
+
+	rec  Record
+	err  error
+	done bool
+}
+
+// PrefixRange returns an iterator over the records of r, a file of the given
+// size, which begin with prefix. Whether a record begins with the prefix is
+// decided by c.Prefix. At most max records are returned, or all of them if
+// max is 0. To stop early, simply stop calling Next.
+func PrefixRange(c Config, r Reader, size int64, prefix []byte, max int) *Iterator {
+	it := &Iterator{c: c, r: r, size: size, prefix: prefix, max: max}
+	// Find the last record earlier than the prefix. The next record will be >= the prefix.
+	res := LowerBound(c, r, size, prefix)
+	switch {
+	case res.Err == io.EOF:
+		it.done = true
+	case res.Err != nil:
+		it.err = res.Err
+		it.done = true
+	}
+	it.off = res.End
+	return it
+}
+
+// Next advances to the next record, returning false when there are no more
+// or there was an error.
+func (it *Iterator) Next() bool {
+	if it.done || it.max > 0 && it.n >= it.max {
+		return false
+	}
+	rec, err := it.read()
+	if err == nil && !it.hasPrefix(rec.Data) {
+		err = io.EOF
+	}
+	if err != nil {
+		if err != io.EOF {
+			it.err = err
+		}
+		it.done = true
+		return false
+	}
+	it.rec = rec
+	it.off = rec.End
+	it.n++
+	return true
+}
+
+// Record returns the current record. Its data is only valid until the next
+// call to Next.
+func (it *Iterator) Record() Record {
+	return it.rec
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) hasPrefix(rec []byte) bool {
+	if it.c.Prefix != nil {
+		return it.c.Prefix(rec, it.prefix)
+	}
+	return bytes.HasPrefix(rec, it.prefix)
+}
+
+// read returns the record at it.off, reading more of the file as needed.
+func (it *Iterator) read() (Record, error) {
+	if s, ok := it.r.(Slicer); ok {
+		rec := readSlice(it.c, s.Bytes(), it.off)
+		return rec, rec.Err
+	}
+	for {
+		i := it.off - it.bufOff
+		if i >= 0 && i < int64(len(it.buf)) {
+			if j := bytes.IndexByte(it.buf[i:], it.c.Delimiter); j >= 0 {
+				end := i + int64(j) + 1
+				return Record{Start: it.off, End: it.bufOff + end, Data: it.buf[i:end]}, nil
+			}
+		} else {
+			i = int64(len(it.buf))
+		}
+		if it.eof || it.off >= it.size {
+			return Record{}, io.EOF
+		}
+
+		// Keep the start of the record, and read more after it.
+		it.buf = append(it.buf[:0], it.buf[i:]...)
+		it.bufOff = it.off
+		n0 := len(it.buf)
+		want := it.c.ChunkSize
+		if want < minBuffer {
+			want = minBuffer
+		}
+		if left := it.size - it.bufOff - int64(n0); left < int64(want) {
+			want = int(left)
+			it.eof = true
+		}
+		if cap(it.buf) < n0+want {
+			buf := make([]byte, n0, 2*(n0+want))
+			copy(buf, it.buf)
+			it.buf = buf
+		}
+		n, err := it.r.ReadAt(it.buf[n0:n0+want], it.bufOff+int64(n0))
+		it.buf = it.buf[:n0+n]
+		if err != nil && err != io.EOF {
+			return Record{}, err
+		}
+		if n < want {
+			it.eof = true
+		}
+	}
+}
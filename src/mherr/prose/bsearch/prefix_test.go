@@ -0,0 +1,91 @@
+package bsearch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrefixRange(t *testing.T) {
+	data := "a.ab.abc.abd.b." + strings.Repeat("c", 20) + ".cd."
+	tests := []struct {
+		desc   string
+		prefix string
+		max    int
+		want   []string
+	}{
+		{
+			desc:   "several records",
+			prefix: "ab",
+			want:   []string{"ab.", "abc.", "abd."},
+		},
+		{
+			desc:   "first record",
+			prefix: "a",
+			want:   []string{"a.", "ab.", "abc.", "abd."},
+		},
+		{
+			desc:   "limited to max",
+			prefix: "a",
+			max:    2,
+			want:   []string{"a.", "ab."},
+		},
+		{
+			desc:   "long records spanning several reads",
+			prefix: "c",
+			want:   []string{strings.Repeat("c", 20) + ".", "cd."},
+		},
+		{
+			desc:   "no match",
+			prefix: "x",
+		},
+	}
+	cfg := Config{
+		ChunkSize: 4,
+		Delimiter: '.',
+		Less: func(l, r []byte) bool {
+			return string(l) < string(r)
+		},
+	}
+
+	for _, c := range tests {
+		for name, r := range readers(data) {
+			it := PrefixRange(cfg, r, int64(len(data)), []byte(c.prefix), c.max)
+			var got []string
+			for it.Next() {
+				got = append(got, string(it.Record().Data))
+			}
+			if it.Err() != nil {
+				t.Fatalf("test(%v) with %v: %v", c.desc, name, it.Err())
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("test(%v) with %v: got %q, want %q", c.desc, name, got, c.want)
+			}
+		}
+	}
+}
+
+func TestPrefixRangeBuffering(t *testing.T) {
+	// Reads through a cache in small blocks, filling the buffer several times.
+	data := strings.Repeat("x.", 5000)
+	c := NewBlockCache(7, 10)
+	cfg := Config{
+		ChunkSize: 3,
+		Delimiter: '.',
+		Less: func(l, r []byte) bool {
+			return string(l) < string(r)
+		},
+	}
+	r := c.Reader(strings.NewReader(data), int64(len(data)))
+	it := PrefixRange(cfg, r, int64(len(data)), []byte("x"), 0)
+	n := 0
+	for it.Next() {
+		if rec := it.Record(); rec.Start != int64(2*n) || string(rec.Data) != "x." {
+			t.Fatalf("record %v is %v", n, rec)
+		}
+		n++
+	}
+	if n != 5000 || it.Err() != nil {
+		t.Fatalf("got %v records, %v", n, it.Err())
+	}
+}
@@ -0,0 +1,33 @@
+// Writes sparse index files alongside ngram files, to speed up searching them.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mherr/prose/ngram"
+	"os"
+)
+
+var every = flag.Int("every", 256, "Index every Nth ngram.")
+
+func usage() {
+	flag.Usage()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = func() { fmt.Print("usage: ngram-index [-every N] [filename]...\n") }
+	flag.Parse()
+
+	filenames := flag.Args()
+	if len(filenames) == 0 || *every < 1 {
+		usage()
+	}
+
+	for _, fname := range filenames {
+		if err := ngram.WriteIndex(fname, *every); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+}
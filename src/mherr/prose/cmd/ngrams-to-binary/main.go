@@ -0,0 +1,32 @@
+// Converts ngram flat files to the compact binary format, written alongside
+// them with a .bin extension.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mherr/prose/ngram"
+	"os"
+)
+
+func usage() {
+	flag.Usage()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = func() { fmt.Print("usage: ngrams-to-binary [filename]...\n") }
+	flag.Parse()
+
+	filenames := flag.Args()
+	if len(filenames) == 0 {
+		usage()
+	}
+
+	for _, fname := range filenames {
+		if err := ngram.ConvertToBinary(fname, ngram.BinaryName(fname)); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+}
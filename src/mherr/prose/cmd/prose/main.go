@@ -7,13 +7,35 @@ import (
 	"mherr/prose/conio"
 	"mherr/prose/ngram"
 	"mherr/prose/view"
+	"mherr/prose/wordwrap"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
-var errExit = errors.New("exit requested")
+// predictionCacheSize is the number of corpus lookups to remember.
+const predictionCacheSize = 1000
+
+var (
+	errExit = errors.New("exit requested")
+
+	personalWeight = flag.Int("personal-weight", 2, "How strongly ngrams learned from your own writing are preferred over the corpus.")
+	showScores     = flag.Bool("scores", false, "Show the score of each prediction.")
+	phrases        = flag.Bool("phrases", false, "Predict the rest of likely phrases as well as the next word.")
+	top            = flag.Int("top", ngram.Top, "The number of ngrams of each length predicted from each source.")
+	panel          = flag.String("panel", "bottom", "Where predictions are shown: bottom, popup next to the cursor, or inline as ghost text after it.")
+	panelHeight    = flag.Int("panel-height", 8, "The most predictions shown at once.")
+	keys           = flag.String("keys", ";1234567", "The keys which accept each prediction shown, in order. Tab also accepts the first.")
+	poll           = flag.Duration("poll", 2*time.Second, "How often to check whether the file has been changed by another program, or 0 for never.")
+	autosave       = flag.Duration("autosave", 10*time.Second, "How often unsaved changes are written to a swap file, to be recovered after a crash, or 0 for never.")
+	budget         = flag.Duration("budget", 100*time.Millisecond, "The longest time to spend predicting text, or 0 for no limit. Predictions which take longer are left out.")
+	markdown       = flag.String("markdown", "auto", "Whether to edit the file as Markdown: on, off, or auto for files named *.md or *.markdown.")
+)
 
 func usage() {
 	flag.Usage()
@@ -23,18 +45,43 @@ func usage() {
 func main() {
 	ngram.ResourcePath = filepath.Dir(os.Args[0])
 
-	flag.Usage = func() { fmt.Print("usage: prose [filename]\n") }
+	flag.Usage = func() {
+		fmt.Print("usage: prose [flags] [filename]\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 	filename := flag.Arg(0)
 	if filename == "" {
 		usage()
 	}
+	where, err := view.ParsePanel(*panel)
+	if err != nil || *panelHeight < 1 || *keys == "" {
+		usage()
+	}
+	var md bool
+	switch *markdown {
+	case "on":
+		md = true
+	case "off":
+	case "auto":
+		ext := strings.ToLower(filepath.Ext(filename))
+		md = ext == ".md" || ext == ".markdown"
+	default:
+		usage()
+	}
+	ngram.Top = *top
 
 	t, err := conio.Raw()
 	if err != nil {
 		panic(err)
 	}
+	var d *view.Doc
 	fail := func(err error) {
+		if d != nil {
+			d.Autosave()
+			d.FinishLearning()
+		}
+		conio.BracketedPaste(false)
 		conio.Restore(t)
 		conio.Escape(conio.ClearScreen)
 		conio.Escape(conio.Home)
@@ -42,48 +89,134 @@ func main() {
 		os.Exit(1)
 	}
 	defer func() {
+		conio.BracketedPaste(false)
 		if err := conio.Restore(t); err != nil {
 			panic(err)
 		}
 	}()
 
+	conio.BracketedPaste(true)
 	conio.Escape(conio.ClearScreen)
 	conio.Escape(conio.Home)
 
-	seq := pollTerminal()
-	winChanged := make(chan os.Signal)
+	term := pollTerminal()
+	winChanged := make(chan os.Signal, 1)
 	signal.Notify(winChanged, syscall.SIGWINCH)
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP, syscall.SIGTERM)
 
-	d, err := view.New(filename)
+	corpus := ngram.NewFiles(ngram.ResourcePath)
+	defer corpus.Close()
+	personal := ngram.NewPersonal(ngram.ResourcePath)
+	defer personal.Close()
+	p := ngram.Blend(
+		ngram.Weighted{Predictor: ngram.NewCache(corpus, predictionCacheSize), Weight: 1},
+		ngram.Weighted{Predictor: personal, Weight: *personalWeight},
+	)
+	// Without a case table, words are only capitalized at the start of a sentence.
+	cases, err := ngram.LoadCases(filepath.Join(ngram.ResourcePath, ngram.CasesFile))
+	if err != nil && !os.IsNotExist(err) {
+		fail(err)
+	}
+	d, err = view.New(filename, p, view.Options{
+		ShowScores:  *showScores,
+		Budget:      *budget,
+		Cases:       cases,
+		Phrases:     *phrases,
+		Panel:       where,
+		PanelHeight: *panelHeight,
+		Keys:        *keys,
+		Markdown:    md,
+		Recover: func(swap string) bool {
+			conio.Escape(conio.Home)
+			fmt.Printf("%v has unsaved changes to %v. Recover them? (y/N)", swap, filename)
+			s, err := term.key()
+			if err != nil {
+				fail(err)
+			}
+			return s == "y"
+		},
+	})
 	if err != nil {
 		fail(err)
 	}
+	defer func() {
+		// Keep the changes made before a crash.
+		if r := recover(); r != nil {
+			d.Autosave()
+			d.FinishLearning()
+			panic(r)
+		}
+	}()
 
+	var tick, polled <-chan time.Time
+	if *autosave > 0 {
+		ticker := time.NewTicker(*autosave)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	if *poll > 0 {
+		ticker := time.NewTicker(*poll)
+		defer ticker.Stop()
+		polled = ticker.C
+	}
+
+	conio.Escape(conio.ClearScreen)
 	d.Redraw()
 
 out:
 	for {
-		var s string
 		select {
 		case <-winChanged:
 			d.WindowChanged()
 
-		case s = <-seq:
-			err := handleKeypress(s, d, seq)
+		case <-tick:
+			// Failures are shown, and tried again next time.
+			d.Autosave()
+
+		case <-polled:
+			// Failures are shown, and tried again next time.
+			d.CheckDisk()
+
+		case <-hangup:
+			if err := d.Autosave(); err != nil {
+				fail(err)
+			}
+			d.FinishLearning()
+			return
+
+		case s, ok := <-term.keys:
+			if !ok {
+				fail(term.err)
+			}
+			err := handleKeypress(s, d, term)
 			if err == errExit {
 				break out
 			}
 			if err != nil {
 				fail(err)
 			}
+
+		case p := <-d.Predicted():
+			if err := d.ShowPredicted(p); err != nil {
+				fail(err)
+			}
+
+		case err := <-d.LearnFailed():
+			// Shown, but what was saved is not learned again.
+			d.ShowLearnFailed(err)
 		}
 	}
 
+	// Unsaved changes were abandoned.
+	if err := d.Close(); err != nil {
+		fail(err)
+	}
 	conio.Escape(conio.ClearScreen)
 	conio.Escape(conio.Home)
 }
 
-func handleKeypress(s string, d *view.Doc, seq chan string) error {
+func handleKeypress(s string, d *view.Doc, term *terminal) error {
 	switch {
 	case s == "\x01": // Control-A
 		d.Auto(true)
@@ -94,15 +227,47 @@ func handleKeypress(s string, d *view.Doc, seq chan string) error {
 	case s == "\x1b[B":
 		d.Move(1, 0)
 	case s == "\x1b[C":
-		d.Move(0, 1)
+		// Right accepts any ghost text, or moves the cursor.
+		accepted, err := d.AcceptGhost()
+		if !accepted {
+			d.Move(0, 1)
+		}
+		return err
 	case s == "\x1b[D":
 		d.Move(0, -1)
+	case s == "\x1b[1;2A": // Shift-Up
+		d.Select(-1, 0)
+	case s == "\x1b[1;2B": // Shift-Down
+		d.Select(1, 0)
+	case s == "\x1b[1;2C": // Shift-Right
+		d.Select(0, 1)
+	case s == "\x1b[1;2D": // Shift-Left
+		d.Select(0, -1)
+	case s == "\x1b[1;2H": // Shift-Home
+		d.Select(0, -900)
+	case s == "\x1b[1;2F": // Shift-End
+		d.Select(0, 900)
+	case s == "\x00": // Control-Space
+		d.SetMark()
+	case s == "\x07": // Control-G
+		d.ClearMark()
+	case s == "\x17": // Control-W
+		d.Cut()
+	case s == "\x1bw": // Alt-W
+		d.Copy()
+	case s == "\x16": // Control-V
+		d.Paste()
+	case s == "\x1bv": // Alt-V
+		d.PasteOlder()
 	case s == "\x03": // Control-C
 		fallthrough
 	case s == "\x04": // Control-D
 		if d.Dirty() {
 			d.WriteStatus("Changes not saved, exit anyway? (y/N)")
-			s := <-seq
+			s, err := term.key()
+			if err != nil {
+				return err
+			}
 			if s == "y" {
 				return errExit
 			}
@@ -118,14 +283,34 @@ func handleKeypress(s string, d *view.Doc, seq chan string) error {
 		d.Move(-d.Height()*3/2, 0)
 	case s == "\x1b[6~": // Page Down
 		d.Move(d.Height()*3/2, 0)
+	case strings.HasPrefix(s, conio.PasteStart):
+		text, _ := conio.Pasted(s)
+		d.PasteText(text)
 	case s == "\t":
-		return d.Edit(s[0])
-	case len(s) == 1 && s[0] >= 32 && s[0] < 127:
-		return d.Edit(s[0])
+		return d.Edit('\t')
+	case printable(s):
+		r, _ := utf8.DecodeRuneInString(s)
+		return d.Edit(r)
 	case s == "\r": // Enter
 		d.Enter()
 	case s == "\x13": // Save
-		return d.Save()
+		err := d.Save()
+		if err == view.ErrChanged {
+			return saveChanged(d, term)
+		}
+		return err
+	case s == "\x05": // Control-E
+		return d.AcceptPhrase(true)
+	case s == "\x0e": // Control-N
+		return d.AcceptPhrase(false)
+	case s == "\x1a": // Control-Z
+		d.Undo()
+	case s == "\x19": // Control-Y
+		d.Redo()
+	case s == "\x06": // Control-F
+		return search(d, term)
+	case s == "\x12": // Control-R
+		return replace(d, term)
 	case s == "\b":
 		d.CtlBackspace()
 	case s == "\x7f":
@@ -140,12 +325,179 @@ func handleKeypress(s string, d *view.Doc, seq chan string) error {
 	return nil
 }
 
-func pollTerminal() chan string {
-	ch := make(chan string)
+// search runs an incremental search until it is accepted with Enter or
+// cancelled with Control-G. Any other key ends the search and is handled as
+// normal.
+func search(d *view.Doc, term *terminal) error {
+	d.StartSearch()
+	var query string
+	for {
+		s, err := term.key()
+		if err != nil {
+			return err
+		}
+		switch {
+		case s == "\r":
+			d.EndSearch(true)
+			return nil
+		case s == "\x07": // Control-G
+			d.EndSearch(false)
+			return nil
+		case s == "\x06" || s == "\x1b[B": // Control-F, Down
+			d.SearchNext(1)
+		case s == "\x02" || s == "\x1b[A": // Control-B, Up
+			d.SearchNext(-1)
+		case s == "\x7f":
+			query = query[:wordwrap.PrevBoundary(query, len(query))]
+			d.Search(query)
+		case printable(s):
+			query += s
+			d.Search(query)
+		case strings.HasPrefix(s, conio.PasteStart):
+			query += pastedLine(s)
+			d.Search(query)
+		default:
+			d.EndSearch(true)
+			return handleKeypress(s, d, term)
+		}
+	}
+}
+
+// replace prompts for a search string and its replacement, then asks for
+// confirmation at each match.
+func replace(d *view.Doc, term *terminal) error {
+	from, ok, err := prompt(d, term, "Replace: ")
+	if err != nil || !ok || from == "" {
+		d.Redraw()
+		return err
+	}
+	to, ok, err := prompt(d, term, fmt.Sprintf("Replace %q with: ", from))
+	if err != nil || !ok {
+		d.Redraw()
+		return err
+	}
+	if !d.StartReplace(from, to) {
+		return nil
+	}
+	for {
+		s, err := term.key()
+		if err != nil {
+			return err
+		}
+		var more bool
+		switch s {
+		case "y", " ":
+			more = d.Replace(to)
+		case "n", "\x7f":
+			more = d.SkipReplace()
+		case "!":
+			d.ReplaceAll(to)
+		default:
+			d.EndSearch(true)
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// prompt reads a line of text in the status line. It returns false if the
+// prompt was cancelled with Control-G.
+func prompt(d *view.Doc, term *terminal, label string) (string, bool, error) {
+	var text string
+	for {
+		d.WriteStatus(label + text)
+		s, err := term.key()
+		if err != nil {
+			return "", false, err
+		}
+		switch {
+		case s == "\r":
+			return text, true, nil
+		case s == "\x07": // Control-G
+			return "", false, nil
+		case s == "\x7f":
+			text = text[:wordwrap.PrevBoundary(text, len(text))]
+		case printable(s):
+			text += s
+		case strings.HasPrefix(s, conio.PasteStart):
+			text += pastedLine(s)
+		}
+	}
+}
+
+// pastedLine returns the text pasted in s as a single line, for the search or
+// a prompt. Its lines are joined by spaces, as in a paragraph, and characters
+// which are not printable are left out.
+func pastedLine(s string) string {
+	text, _ := conio.Pasted(s)
+	text = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(text)
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// printable returns whether s is a single printable character.
+func printable(s string) bool {
+	r, n := utf8.DecodeRuneInString(s)
+	return n == len(s) && r != utf8.RuneError && unicode.IsPrint(r)
+}
+
+// terminal is the keys read from the terminal in the background.
+type terminal struct {
+	keys chan string
+	// Why the terminal could not be read, once keys is closed.
+	err error
+}
+
+func pollTerminal() *terminal {
+	t := &terminal{keys: make(chan string)}
 	go func() {
+		// conio panics if the terminal cannot be read. The document is
+		// only touched by the main goroutine, so it is left to autosave
+		// and exit when it finds keys closed.
+		defer func() {
+			if r := recover(); r != nil {
+				t.err = fmt.Errorf("could not read from the terminal: %v", r)
+				close(t.keys)
+			}
+		}()
 		for {
-			ch <- conio.Seq()
+			t.keys <- conio.Seq()
 		}
 	}()
-	return ch
+	return t
+}
+
+// key waits for the next key, or returns an error if the terminal cannot be
+// read.
+func (t *terminal) key() (string, error) {
+	s, ok := <-t.keys
+	if !ok {
+		return "", t.err
+	}
+	return s, nil
+}
+
+// saveChanged asks what to do when saving a file changed by another program.
+func saveChanged(d *view.Doc, term *terminal) error {
+	d.WriteStatus("File changed on disk: (o)verwrite it, (r)eload it, (m)erge with it, or cancel?")
+	s, err := term.key()
+	if err != nil {
+		return err
+	}
+	switch s {
+	case "o":
+		return d.Overwrite()
+	case "r":
+		return d.Reload()
+	case "m":
+		_, err := d.Merge()
+		return err
+	}
+	d.Redraw()
+	return nil
 }
@@ -3,9 +3,13 @@ package conio
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"syscall"
+	"unicode/utf8"
 	"unsafe"
 )
 
@@ -20,6 +24,10 @@ const (
 	tcSets = 0x5402 // syscall.TCSETS
 
 	CodeEsc = 27
+
+	// Pasted text is surrounded by these sequences in bracketed paste mode.
+	PasteStart = "\x1b[200~"
+	PasteEnd   = "\x1b[201~"
 )
 
 // State contains the state of a terminal.
@@ -68,6 +76,9 @@ func Size() (width, height int, err error) {
 
 // char returns a single character.
 func char() byte {
+	if tty == nil {
+		panic(ttyErr)
+	}
 	bs := make([]byte, 1)
 	n, err := tty.Read(bs)
 	if err != nil {
@@ -80,10 +91,15 @@ func char() byte {
 }
 
 // Returns a single character, or an ANSI escape sequence from the tty.
+// Multi-byte UTF-8 characters are returned whole, as is text pasted in
+// bracketed paste mode, from PasteStart to PasteEnd.
 func Seq() string {
 	var buf bytes.Buffer
 	c := char()
 	buf.WriteByte(c)
+	if c >= 0xc0 {
+		return utf8Seq(&buf, c)
+	}
 	if c != CodeEsc {
 		return buf.String()
 	}
@@ -105,24 +121,80 @@ func Seq() string {
 		buf.WriteByte(c)
 		// ANSI escape sequences end with a character in this range.
 		if c >= 64 && c <= 126 {
+			if buf.String() == PasteStart {
+				return pasteSeq(&buf)
+			}
 			return buf.String()
 		}
 	}
 }
 
-var tty *os.File
+// utf8Seq reads the continuation bytes of the UTF-8 character with the given
+// leading byte. A byte which cannot lead a character is returned alone.
+func utf8Seq(buf *bytes.Buffer, lead byte) string {
+	n := 0
+	switch {
+	case lead >= 0xf8:
+		n = 0
+	case lead >= 0xf0:
+		n = 3
+	case lead >= 0xe0:
+		n = 2
+	default:
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		buf.WriteByte(char())
+		if utf8.FullRune(buf.Bytes()) {
+			break
+		}
+	}
+	return buf.String()
+}
 
-func init() {
-	var err error
-	tty, err = os.Open("/dev/tty")
-	if err != nil {
-		panic(err)
+// pasteSeq reads pasted text up to the end of the paste.
+func pasteSeq(buf *bytes.Buffer) string {
+	for !bytes.HasSuffix(buf.Bytes(), []byte(PasteEnd)) {
+		buf.WriteByte(char())
 	}
+	return buf.String()
 }
 
+// Pasted returns the text pasted in a sequence returned by Seq.
+func Pasted(s string) (string, bool) {
+	if !strings.HasPrefix(s, PasteStart) || !strings.HasSuffix(s, PasteEnd) {
+		return "", false
+	}
+	return s[len(PasteStart) : len(s)-len(PasteEnd)], true
+}
+
+// BracketedPaste turns bracketed paste mode on or off. When on, the terminal
+// marks pasted text so it can be told apart from typing.
+func BracketedPaste(on bool) {
+	if on {
+		Escape("?2004h")
+	} else {
+		Escape("?2004l")
+	}
+}
+
+var (
+	tty *os.File
+	// ttyErr is why the tty could not be opened, if it could not. Reading
+	// from it then panics.
+	ttyErr error
+)
+
+func init() {
+	tty, ttyErr = os.Open("/dev/tty")
+}
+
+// Output is where the terminal is written to.
+var Output io.Writer = os.Stdout
+
 // Escape writes out an escape sequence.
 func Escape(t string) {
-	fmt.Printf("\x1b[%v", t)
+	fmt.Fprintf(Output, "\x1b[%v", t)
 }
 
 // Escapef writes out an escape sequence.
@@ -132,12 +204,18 @@ func Escapef(pat string, args ...interface{}) {
 
 // Out writes the output to the terminal.
 func Out(t string) {
-	fmt.Print(t)
+	fmt.Fprint(Output, t)
 }
 
 // Outf writes out text to the terminal.
 func Outf(pat string, args ...interface{}) {
-	fmt.Printf(pat, args...)
+	fmt.Fprintf(Output, pat, args...)
+}
+
+// Clipboard copies text to the terminal's clipboard, using the OSC 52 escape
+// sequence. Terminals which do not support it ignore the request.
+func Clipboard(t string) {
+	fmt.Fprintf(Output, "\x1b]52;c;%v\x07", base64.StdEncoding.EncodeToString([]byte(t)))
 }
 
 // Pos positions the cursor at the given y, x location..
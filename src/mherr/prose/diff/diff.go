@@ -0,0 +1,186 @@
+// Package diff compares and merges sequences of lines, such as the paragraphs
+// of a document.
+package diff
+
+// Pair is the index of a line in each of two sequences which is the same.
+type Pair struct {
+	A, B int
+}
+
+// Common returns the pairs of lines of a longest common subsequence of a and
+// b, in order. It uses Myers' linear space algorithm, so it takes time in
+// proportion to the size of the inputs and the number of lines which differ,
+// and memory in proportion to the size of the inputs alone.
+func Common(a, b []string) []Pair {
+	return common(a, b, 0, 0, nil)
+}
+
+// common appends the pairs of a longest common subsequence of a and b to
+// res, offset by i and j.
+func common(a, b []string, i, j int, res []Pair) []Pair {
+	// Lines at the start and end which are the same are matched directly,
+	// since documents are usually mostly unchanged.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	for k := 0; k < pre; k++ {
+		res = append(res, Pair{i + k, j + k})
+	}
+
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if len(ma) > 0 && len(mb) > 0 {
+		if x, y, ok := split(ma, mb); ok {
+			res = common(ma[:x], mb[:y], i+pre, j+pre, res)
+			res = common(ma[x:], mb[y:], i+pre+x, j+pre+y, res)
+		}
+	}
+
+	for k := 0; k < suf; k++ {
+		res = append(res, Pair{i + len(a) - suf + k, j + len(b) - suf + k})
+	}
+	return res
+}
+
+// split finds the middle of a shortest edit script from a to b, searching
+// forwards from the start and backwards from the end until the two meet. It
+// returns false if a and b have no lines in common.
+func split(a, b []string) (int, int, bool) {
+	n, m := len(a), len(b)
+	max := (n + m + 1) / 2
+	off := max
+	// The furthest x reached on each diagonal k = x-y, forwards and
+	// backwards from the end, or -1.
+	vf := make([]int, 2*max+2)
+	vb := make([]int, 2*max+2)
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[off+1], vb[off+1] = 0, 0
+	delta := n - m
+	// Whether the paths meet on a forward step.
+	front := delta%2 != 0
+	// Diagonals which have left the edit graph are not searched again.
+	var fStart, fEnd, bStart, bEnd int
+
+	for d := 0; d < max; d++ {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			var x int
+			if k == -d || k != d && vf[off+k-1] < vf[off+k+1] {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case front:
+				if kb := off + delta - k; kb >= 0 && kb < len(vb) && vb[kb] != -1 && x >= n-vb[kb] {
+					return x, y, true
+				}
+			}
+		}
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			var x int
+			if k == -d || k != d && vb[off+k-1] < vb[off+k+1] {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !front:
+				if kf := off + delta - k; kf >= 0 && kf < len(vf) && vf[kf] != -1 && vf[kf] >= n-x {
+					return vf[kf], vf[kf] - (kf - off), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// Merge combines the changes made to base in ours and in theirs. Where both
+// changed the same lines differently, both versions are kept, between
+// conflict markers naming them, and the conflict is counted.
+func Merge(base, ours, theirs []string, oursName, theirsName string) ([]string, int) {
+	inOurs := make(map[int]int)
+	for _, p := range Common(base, ours) {
+		inOurs[p.A] = p.B
+	}
+	inTheirs := make(map[int]int)
+	for _, p := range Common(base, theirs) {
+		inTheirs[p.A] = p.B
+	}
+
+	var (
+		res       []string
+		conflicts int
+		// The start of the lines not yet merged in each version.
+		i, j, k int
+	)
+	// merge merges the lines of each version up to base[bi], ours[oj] and
+	// theirs[tk], which are unchanged.
+	merge := func(bi, oj, tk int) {
+		b, o, t := base[i:bi], ours[j:oj], theirs[k:tk]
+		switch {
+		case equal(o, b):
+			res = append(res, t...)
+		case equal(t, b), equal(o, t):
+			res = append(res, o...)
+		default:
+			res = append(res, "<<<<<<< "+oursName)
+			res = append(res, o...)
+			res = append(res, "=======")
+			res = append(res, t...)
+			res = append(res, ">>>>>>> "+theirsName)
+			conflicts++
+		}
+		i, j, k = bi, oj, tk
+	}
+
+	for bi := range base {
+		oj, ok1 := inOurs[bi]
+		tk, ok2 := inTheirs[bi]
+		if !ok1 || !ok2 {
+			continue
+		}
+		merge(bi, oj, tk)
+		res = append(res, base[bi])
+		i, j, k = bi+1, oj+1, tk+1
+	}
+	merge(len(base), len(ours), len(theirs))
+	return res, conflicts
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, " ")
+}
+
+func TestCommon(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []Pair
+	}{
+		{"", "", nil},
+		{"a b c", "a b c", []Pair{{0, 0}, {1, 1}, {2, 2}}},
+		{"a b c", "a x c", []Pair{{0, 0}, {2, 2}}},
+		{"a b c d", "b d", []Pair{{1, 0}, {3, 1}}},
+		{"x a b", "a b y", []Pair{{1, 0}, {2, 1}}},
+		{"a b", "c d", nil},
+	}
+	for _, c := range tests {
+		if got := Common(lines(c.a), lines(c.b)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Common(%q, %q): got %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+// lcsLength returns the length of a longest common subsequence of a and b,
+// by dynamic programming.
+func lcsLength(a, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs[0][0]
+}
+
+// checkCommon checks that pairs is a longest common subsequence of a and b.
+func checkCommon(t *testing.T, a, b []string, pairs []Pair, want int) {
+	for i, p := range pairs {
+		if i > 0 && (p.A <= pairs[i-1].A || p.B <= pairs[i-1].B) {
+			t.Fatalf("Common(%q, %q): pairs out of order: %v", a, b, pairs)
+		}
+		if a[p.A] != b[p.B] {
+			t.Fatalf("Common(%q, %q): %v pairs different lines", a, b, p)
+		}
+	}
+	if len(pairs) != want {
+		t.Fatalf("Common(%q, %q): got %v pairs, want %v", a, b, len(pairs), want)
+	}
+}
+
+func TestCommonRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		l := make([]string, r.Intn(20))
+		for i := range l {
+			l[i] = string('a' + rune(r.Intn(4)))
+		}
+		return l
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := random(), random()
+		checkCommon(t, a, b, Common(a, b), lcsLength(a, b))
+	}
+}
+
+func TestCommonLarge(t *testing.T) {
+	// A long document, edited at both ends, with many repeated lines.
+	var a []string
+	for i := 0; i < 100000; i++ {
+		if i%2 == 1 {
+			a = append(a, "")
+		} else {
+			a = append(a, fmt.Sprint("paragraph ", i))
+		}
+	}
+	b := append([]string{"new"}, a[1:]...)
+	b[len(b)-1] = "changed"
+	b = append(b[:50000], append([]string{"inserted", ""}, b[50000:]...)...)
+
+	pairs := Common(a, b)
+	checkCommon(t, a, b, pairs, len(a)-2)
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		desc               string
+		base, ours, theirs string
+		want               string
+		conflicts          int
+	}{
+		{"unchanged", "a b c", "a b c", "a b c", "a b c", 0},
+		{"ours changed", "a b c", "a x c", "a b c", "a x c", 0},
+		{"theirs changed", "a b c", "a b c", "a b y", "a b y", 0},
+		{"both changed apart", "a b c d", "x b c d", "a b c y", "x b c y", 0},
+		{"both made the same change", "a b c", "a x c", "a x c", "a x c", 0},
+		{"ours added, theirs deleted", "a b c d", "a n b c d", "a b c", "a n b c", 0},
+		{"ours changed what theirs deleted", "a b c", "a x c", "a c", "a <<<<<<<_ours x ======= >>>>>>>_theirs c", 1},
+		{"both added at the end", "a", "a x", "a y", "a <<<<<<<_ours x ======= y >>>>>>>_theirs", 1},
+		{"conflict", "a b c", "a x c", "a y c", "a <<<<<<<_ours x ======= y >>>>>>>_theirs c", 1},
+		{"from nothing", "", "x", "", "x", 0},
+	}
+	for _, c := range tests {
+		got, n := Merge(lines(c.base), lines(c.ours), lines(c.theirs), "ours", "theirs")
+		s := strings.Replace(strings.Join(got, " "), "< ", "<_", -1)
+		s = strings.Replace(s, "> ", ">_", -1)
+		if s != c.want || n != c.conflicts {
+			t.Errorf("test(%v): got %q with %v conflicts, want %q with %v", c.desc, s, n, c.want, c.conflicts)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package ngram
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mherr/prose/bsearch"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// The binary ngram database format is a sequence of blocks of ngrams, followed
+// by an index of the blocks:
+//
+//	file    := magic block* index offset
+//	block   := ngram*
+//	ngram   := uvarint(shared) uvarint(len(suffix)) suffix uvarint(freq)
+//	index   := uvarint(count) { uvarint(offset) uvarint(len(first)) first }*
+//	offset  := the offset of the index, as a little-endian uint64
+//
+// Within a block, each ngram is stored as the number of bytes it shares with
+// the previous ngram, followed by the rest of its text. The first ngram of
+// each block shares nothing, so that blocks can be read independently. The
+// index holds the offset and first ngram of each block.
+const (
+	binaryMagic = "prose-ngrams-1\n"
+	binaryExt   = ".bin"
+
+	// blockNgrams is the number of ngrams in each block.
+	blockNgrams = 64
+)
+
+var errNotBinary = errors.New("not a binary ngram database")
+
+// binaryDatabase is an ngram database in the binary format.
+type binaryDatabase struct {
+	r bsearch.Reader
+	// The offset and first ngram of each block.
+	offsets []int64
+	firsts  [][]byte
+}
+
+func newBinaryDatabase(r bsearch.Reader, size int64) (*binaryDatabase, error) {
+	magic := make([]byte, len(binaryMagic))
+	var tail [8]byte
+	if size < int64(len(magic)+len(tail)) {
+		return nil, errNotBinary
+	}
+	if _, err := r.ReadAt(magic, 0); err != nil || string(magic) != binaryMagic {
+		return nil, errNotBinary
+	}
+	if _, err := r.ReadAt(tail[:], size-int64(len(tail))); err != nil && err != io.EOF {
+		return nil, err
+	}
+	off := int64(binary.LittleEndian.Uint64(tail[:]))
+	if off < int64(len(magic)) || off > size-int64(len(tail)) {
+		return nil, errNotBinary
+	}
+
+	db := &binaryDatabase{r: r}
+	br := bufio.NewReader(io.NewSectionReader(r, off, size-int64(len(tail))-off))
+	n, err := binary.ReadUvarint(br)
+	for i := uint64(0); i < n && err == nil; i++ {
+		var boff, l uint64
+		if boff, err = binary.ReadUvarint(br); err != nil {
+			break
+		}
+		if l, err = binary.ReadUvarint(br); err != nil {
+			break
+		}
+		first := make([]byte, l)
+		if _, err = io.ReadFull(br, first); err != nil {
+			break
+		}
+		db.offsets = append(db.offsets, int64(boff))
+		db.firsts = append(db.firsts, first)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading block index: %v", err)
+	}
+	// The end of the last block.
+	db.offsets = append(db.offsets, off)
+	return db, nil
+}
+
+func (db *binaryDatabase) scan(prefix string, fn func(text []byte, freq int) bool) error {
+	sought := []byte(prefix)
+
+	// Start with the last block beginning before the prefix, since it may
+	// contain ngrams beginning with the prefix.
+	nblocks := len(db.firsts)
+	b := sort.Search(nblocks, func(i int) bool {
+		return bytes.Compare(db.firsts[i], sought) >= 0
+	})
+	if b > 0 {
+		b--
+	}
+	for ; b < nblocks; b++ {
+		start, end := db.offsets[b], db.offsets[b+1]
+		var data []byte
+		if sl, ok := db.r.(bsearch.Slicer); ok {
+			data = sl.Bytes()[start:end]
+		} else {
+			data = make([]byte, end-start)
+			if _, err := db.r.ReadAt(data, start); err != nil && err != io.EOF {
+				return err
+			}
+		}
+		done, err := scanBlock(data, sought, fn)
+		if done || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanBlock calls fn with each ngram in a block which begins with prefix. It
+// returns true once it finds an ngram after those beginning with prefix, or fn
+// returns false.
+func scanBlock(data, prefix []byte, fn func(text []byte, freq int) bool) (bool, error) {
+	var text []byte
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		shared, err := binary.ReadUvarint(r)
+		if err != nil {
+			return false, err
+		}
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			return false, err
+		}
+		if shared > uint64(len(text)) || l > uint64(r.Len()) {
+			return false, errors.New("corrupt block")
+		}
+		text = text[:shared]
+		start := len(data) - r.Len()
+		text = append(text, data[start:start+int(l)]...)
+		r.Seek(int64(l), io.SeekCurrent)
+		freq, err := binary.ReadUvarint(r)
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case bytes.HasPrefix(text, prefix):
+			if !fn(text, int(freq)) {
+				return true, nil
+			}
+		case bytes.Compare(text, prefix) > 0:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// BinaryWriter writes an ngram database in the binary format. Ngrams must be
+// added in sorted order.
+type BinaryWriter struct {
+	w   *bufio.Writer
+	off int64
+	err error
+
+	// The previous ngram, and the number added to the current block.
+	prev    []byte
+	inBlock int
+
+	offsets []int64
+	firsts  [][]byte
+	tmp     [binary.MaxVarintLen64]byte
+}
+
+// NewBinaryWriter returns a writer of a binary ngram database to w.
+func NewBinaryWriter(w io.Writer) *BinaryWriter {
+	bw := &BinaryWriter{w: bufio.NewWriter(w)}
+	bw.write([]byte(binaryMagic))
+	return bw
+}
+
+func (bw *BinaryWriter) write(b []byte) {
+	if bw.err != nil {
+		return
+	}
+	n, err := bw.w.Write(b)
+	bw.off += int64(n)
+	bw.err = err
+}
+
+func (bw *BinaryWriter) uvarint(v uint64) {
+	bw.write(bw.tmp[:binary.PutUvarint(bw.tmp[:], v)])
+}
+
+// Add adds an ngram to the database.
+func (bw *BinaryWriter) Add(text string, freq int) error {
+	if bw.err != nil {
+		return bw.err
+	}
+	t := []byte(text)
+	if bw.prev != nil && bytes.Compare(t, bw.prev) <= 0 {
+		return fmt.Errorf("ngram %q is not sorted after %q", text, bw.prev)
+	}
+	if freq < 0 {
+		return fmt.Errorf("ngram %q has negative frequency %v", text, freq)
+	}
+
+	shared := 0
+	if bw.inBlock == blockNgrams || bw.prev == nil {
+		bw.offsets = append(bw.offsets, bw.off)
+		bw.firsts = append(bw.firsts, t)
+		bw.inBlock = 0
+	} else {
+		for shared < len(t) && shared < len(bw.prev) && t[shared] == bw.prev[shared] {
+			shared++
+		}
+	}
+	bw.uvarint(uint64(shared))
+	bw.uvarint(uint64(len(t) - shared))
+	bw.write(t[shared:])
+	bw.uvarint(uint64(freq))
+	bw.prev = t
+	bw.inBlock++
+	return bw.err
+}
+
+// Close writes the block index. It does not close the underlying writer.
+func (bw *BinaryWriter) Close() error {
+	index := bw.off
+	bw.uvarint(uint64(len(bw.offsets)))
+	for i, off := range bw.offsets {
+		bw.uvarint(uint64(off))
+		bw.uvarint(uint64(len(bw.firsts[i])))
+		bw.write(bw.firsts[i])
+	}
+	var tail [8]byte
+	binary.LittleEndian.PutUint64(tail[:], uint64(index))
+	bw.write(tail[:])
+	if bw.err != nil {
+		return bw.err
+	}
+	return bw.w.Flush()
+}
+
+// ConvertToBinary writes a binary version of the ngram flat file src to dst.
+func ConvertToBinary(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst + ".tmp")
+
+	bw := NewBinaryWriter(out)
+	s := bufio.NewScanner(in)
+	for s.Scan() {
+		rec := newRecord(append(s.Bytes(), '\n'))
+		if rec.Text == nil {
+			continue
+		}
+		if err := bw.Add(string(rec.Text), rec.Freq()); err != nil {
+			out.Close()
+			return fmt.Errorf("%v: %v", src, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := bw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(dst+".tmp", dst)
+}
+
+// BinaryName returns the name of the binary version of an ngram flat file.
+func BinaryName(filename string) string {
+	return filename[:len(filename)-len(filepath.Ext(filename))] + binaryExt
+}
@@ -0,0 +1,99 @@
+package ngram
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBinary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "Binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Enough ngrams to fill several blocks.
+	ngrams := make(map[string]int)
+	for i := 0; i < 500; i++ {
+		ngrams[fmt.Sprintf("w%03d x%v", i, i%7)] = i + 1
+	}
+	txt := filepath.Join(dir, "ngrams.2.txt")
+	f, err := os.Create(txt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(f, ngrams); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	bin := BinaryName(txt)
+	if err := ConvertToBinary(txt, bin); err != nil {
+		t.Fatal(err)
+	}
+	for _, prefix := range []string{"w", "w0", "w00", "w063 ", "w064", "w127 x1", "w499", "w5", "a", "z"} {
+		want, err := Find(txt, prefix, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Find(bin, prefix, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Find(%q): got %v, want %v", prefix, got, want)
+		}
+		wantTotal, _ := Total(txt, prefix)
+		if got, err := Total(bin, prefix); err != nil || got != wantTotal {
+			t.Fatalf("Total(%q): got %v, %v, want %v", prefix, got, err, wantTotal)
+		}
+	}
+
+	tst, _ := os.Stat(txt)
+	bst, _ := os.Stat(bin)
+	if bst.Size() >= tst.Size() {
+		t.Fatalf("binary file is %v bytes, no smaller than %v", bst.Size(), tst.Size())
+	}
+}
+
+func TestBinaryUnsorted(t *testing.T) {
+	bw := NewBinaryWriter(ioutil.Discard)
+	if err := bw.Add("b", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Add("a", 1); err == nil {
+		t.Fatal("added an unsorted ngram")
+	}
+}
+
+func TestFilesBinary(t *testing.T) {
+	dir := corpus(t, map[string]string{
+		"ngrams.1.txt":     "cat\t10\ncatalogue\t3\n",
+		"ngrams.1.all.txt": "cat\t1\ncatalogue\t1\ncatamaran\t1\n",
+		"ngrams.2.txt":     "the cat\t7\nthe catalogue\t9\n",
+	})
+	defer os.RemoveAll(dir)
+	names, _ := filepath.Glob(filepath.Join(dir, "*.txt"))
+	for _, txt := range names {
+		if err := ConvertToBinary(txt, BinaryName(txt)); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(txt)
+	}
+
+	f := NewFiles(dir)
+	defer f.Close()
+	got, err := f.Predict(context.Background(), "The cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Matches{{"alogue", 9, 2, 9.0 / 16, 0}, {"amaran", 1, 1, 0.4 / 3, 0}}
+	if !sameMatches(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,218 @@
+package ngram
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// CasesFile is the name of the case table written by ngrams-from-text, within
+// ResourcePath.
+const CasesFile = "cases.txt"
+
+// Cases maps lower-case words to the casing they usually have in the corpus,
+// for the words not usually written in lower case, such as "London" or "NATO".
+type Cases map[string]string
+
+// CountCases adds the number of times each form of each word appears in the
+// text read from r to forms. Words are split as by Count. The first word of a
+// sentence is not counted, since its casing says nothing about the word.
+func CountCases(r io.Reader, forms map[string]int) error {
+	var (
+		br   = bufio.NewReader(r)
+		word []rune
+		// Whether the next word begins a sentence, and whether a word is
+		// being read.
+		start  = true
+		inWord = false
+	)
+	endWord := func() {
+		if len(word) > 0 && !start {
+			forms[string(word)]++
+		}
+		if inWord {
+			start = false
+		}
+		word = word[:0]
+		inWord = false
+	}
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			endWord()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case punct[c] || (ambiguous[c] && !inWord):
+			endWord()
+			switch c {
+			case '.', '!', '?', '\n':
+				start = true
+			}
+		case c == '\t' || c == ' ':
+			endWord()
+		case isWordRune(c):
+			word = append(word, c)
+			inWord = true
+		}
+	}
+}
+
+// DominantCases returns the table of the words in forms, as counted by
+// CountCases, whose most common form is not lower case.
+func DominantCases(forms map[string]int) Cases {
+	best := make(map[string]string)
+	for form, n := range forms {
+		lower := strings.ToLower(form)
+		b, ok := best[lower]
+		if !ok || n > forms[b] || n == forms[b] && form > b {
+			best[lower] = form
+		}
+	}
+	cs := make(Cases)
+	for lower, form := range best {
+		if form != lower {
+			cs[lower] = form
+		}
+	}
+	return cs
+}
+
+// Write writes the table to w, one tab-separated word and form per line.
+func (cs Cases) Write(w io.Writer) error {
+	var words []string
+	for s := range cs {
+		words = append(words, s)
+	}
+	sort.Strings(words)
+
+	b := bufio.NewWriter(w)
+	for _, s := range words {
+		fmt.Fprintf(b, "%v\t%v\n", s, cs[s])
+	}
+	return b.Flush()
+}
+
+// LoadCases reads a table written by Write.
+func LoadCases(filename string) (Cases, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cs := make(Cases)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Split(s.Text(), "\t")
+		if len(fields) != 2 || !strings.EqualFold(fields[0], fields[1]) {
+			return nil, fmt.Errorf("%v: bad line %q", filename, s.Text())
+		}
+		cs[fields[0]] = fields[1]
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// Cased returns a Predictor whose predictions match the casing of the text
+// typed: capitalized at the start of a sentence, in capitals when the user is
+// typing in capitals, and otherwise as usually written in the corpus,
+// according to cs, which may be nil.
+//
+// Only the sentence being typed is passed to p. When a prediction changes the
+// case of the word being typed, it replaces it.
+func Cased(p Predictor, cs Cases) Predictor {
+	return PredictorFunc(func(ctx context.Context, text string) (Matches, error) {
+		sentence := text[strings.LastIndexAny(text, ".!?\n")+1:]
+		ms, err := p.Predict(ctx, strings.TrimLeft(sentence, " "))
+		if err != nil {
+			return nil, err
+		}
+		for i := range ms {
+			ms[i] = cs.match(sentence, ms[i])
+		}
+		return ms, nil
+	})
+}
+
+// match returns m cased to follow sentence, the sentence being typed.
+func (cs Cases) match(sentence string, m Match) Match {
+	frag := fragment(sentence)
+	before := sentence[:len(sentence)-len(frag)]
+	if m.Replace == 0 {
+		m.Text = frag + m.Text
+	}
+
+	// Whether the user is typing in capitals is judged from the word being
+	// typed, or the last word if a new one is being predicted.
+	typed := frag
+	if typed == "" {
+		typed = fragment(strings.TrimRight(sentence, " "))
+	}
+	caps := capitals(typed)
+	first := strings.TrimSpace(before) == ""
+
+	words := strings.Split(m.Text, " ")
+	for i, w := range words {
+		switch {
+		case w == "":
+		case caps:
+			words[i] = strings.ToUpper(w)
+		case cs[strings.ToLower(w)] != "":
+			words[i] = cs[strings.ToLower(w)]
+		}
+		if first && w != "" {
+			words[i] = title(words[i])
+			first = false
+		}
+	}
+	m.Text = strings.Join(words, " ")
+
+	switch {
+	case m.Replace > 0:
+	case strings.HasPrefix(m.Text, frag):
+		// The word typed is already cased correctly.
+		m.Text = m.Text[len(frag):]
+	case strings.ToLower(frag) != frag && strings.EqualFold(m.Text[:min(len(frag), len(m.Text))], frag):
+		// Keep the casing the user chose.
+		m.Text = m.Text[len(frag):]
+	default:
+		m.Replace = len(frag)
+	}
+	return m
+}
+
+// capitals returns whether the word being typed is in capitals, which is
+// only clear after two letters.
+func capitals(word string) bool {
+	letters := 0
+	for _, r := range word {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsUpper(r) {
+			letters++
+		}
+	}
+	return letters >= 2
+}
+
+// title returns word with its first letter in upper case.
+func title(word string) string {
+	for i, r := range word {
+		if unicode.IsLetter(r) {
+			return word[:i] + string(unicode.ToUpper(r)) + word[i+len(string(r)):]
+		}
+	}
+	return word
+}
@@ -0,0 +1,99 @@
+package ngram
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDominantCases(t *testing.T) {
+	forms := make(map[string]int)
+	text := "The cat sat in London. The dog sat in london, with NATO and the cat.\nCat food is sold in London.\n"
+	if err := CountCases(strings.NewReader(text), forms); err != nil {
+		t.Fatal(err)
+	}
+	if forms["The"] != 0 || forms["Cat"] != 0 {
+		t.Fatalf("counted words starting sentences: %v", forms)
+	}
+	got := DominantCases(forms)
+	want := Cases{"london": "London", "nato": "NATO"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestLoadCases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, CasesFile)
+
+	want := Cases{"london": "London", "nato": "NATO"}
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := want.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	got, err := LoadCases(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestCased(t *testing.T) {
+	cs := Cases{"london": "London", "i": "I"}
+	tests := []struct {
+		text string
+		m    Match
+		want Match
+	}{
+		// Mid-sentence, predictions are as usually written.
+		{"we went to the", Match{Text: "re"}, Match{Text: "re"}},
+		{"we went to lon", Match{Text: "don"}, Match{Text: "London", Replace: 3}},
+		{"we went to Lon", Match{Text: "don"}, Match{Text: "don"}},
+		{"we went to ", Match{Text: "london"}, Match{Text: "London"}},
+		{"so ", Match{Text: "i said"}, Match{Text: "I said"}},
+		// Sentences begin with a capital.
+		{"", Match{Text: "the"}, Match{Text: "The"}},
+		{"He left. ", Match{Text: "the"}, Match{Text: "The"}},
+		{"He left. th", Match{Text: "e"}, Match{Text: "The", Replace: 2}},
+		{"He left! Th", Match{Text: "e"}, Match{Text: "e"}},
+		{"hello", Match{Text: " world"}, Match{Text: "Hello world", Replace: 5}},
+		{"Hello", Match{Text: " world"}, Match{Text: " world"}},
+		// Capitals are kept up.
+		{"WE WENT TO TH", Match{Text: "e end"}, Match{Text: "E END"}},
+		{"WE WENT TO ", Match{Text: "london"}, Match{Text: "LONDON"}},
+		// Corrections are cased too.
+		{"we went to lnod", Match{Text: "london", Replace: 4}, Match{Text: "London", Replace: 4}},
+	}
+	for _, c := range tests {
+		var asked string
+		p := Cased(PredictorFunc(func(ctx context.Context, text string) (Matches, error) {
+			asked = text
+			return Matches{c.m}, nil
+		}), cs)
+		got, err := p.Predict(context.Background(), c.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0] != c.want {
+			t.Errorf("Predict(%q) with %v: got %v, want %v", c.text, c.m, got, c.want)
+		}
+		if strings.ContainsAny(asked, ".!") {
+			t.Errorf("Predict(%q): asked about %q, not just the last sentence", c.text, asked)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package ngram
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var (
+	punct = map[rune]bool{
+		'\\': true,
+		'`':  true,
+		'"':  true,
+		'\n': true,
+		'\r': true,
+		',':  true,
+		'.':  true,
+		'!':  true,
+		'[':  true,
+		']':  true,
+		'^':  true,
+		'(':  true,
+		')':  true,
+		'?':  true,
+		'_':  true,
+	}
+
+	// Punctuation which may appear within words as well as without.
+	ambiguous = map[rune]bool{
+		'\'': true,
+		'-':  true,
+	}
+)
+
+// isWordRune returns whether c is part of a word: a letter in any script,
+// a combining mark, or an apostrophe.
+func isWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsMark(c) || c == '\''
+}
+
+type parseState int
+
+const (
+	beforeLine parseState = iota
+	inWord
+	outWord
+)
+
+// Count adds the ngrams of up to maxNgrams words found in the text read from
+// r to ngrams. Words are made of letters in any script, and are lower-cased.
+// If filter is non-zero, only ngrams of exactly maxNgrams words are counted.
+func Count(r io.Reader, ngrams map[string]int, maxNgrams, filter int) error {
+	var (
+		br      = bufio.NewReader(r)
+		state   = beforeLine
+		line    bytes.Buffer
+		offsets = make([]int, maxNgrams)
+		ws      = 0
+
+		emit = func() {
+			l := line.String()
+			if len(l) == 0 {
+				return
+			}
+			l = l[:len(l)-1]
+			off := 0
+			w := 0
+			for {
+				v := l[off:]
+				if filter > 0 {
+					if strings.Count(v, " ") != maxNgrams-1 {
+						break
+					}
+				}
+
+				ngrams[v]++
+				w++
+				if w >= ws-1 {
+					break
+				}
+				off = offsets[w]
+			}
+		}
+
+		pop = func() bool {
+			if ws == 0 {
+				return false
+			}
+			diff := offsets[0]
+			l := line.Bytes()[diff:]
+			line.Reset()
+			line.Write(l)
+			for i := 0; i < ws-1; i++ {
+				offsets[i] = offsets[i+1] - diff
+			}
+			ws--
+			offsets[maxNgrams-1] = 0
+			return true
+		}
+
+		recordLine = func() {
+			for {
+				emit()
+				if !pop() {
+					break
+				}
+			}
+			line.Reset()
+		}
+
+		recordLetter = func(c rune) {
+			line.WriteRune(c)
+		}
+
+		markWordEnd = func() {
+			line.WriteByte(' ')
+			offsets[ws] = line.Len()
+			ws++
+
+			if ws < maxNgrams {
+				return
+			}
+
+			// Write out one entry.
+			emit()
+			pop()
+		}
+	)
+
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		// Some punctuation like ' can appear within a word, or without.
+		case punct[c] || (ambiguous[c] && state != inWord):
+			switch state {
+			case beforeLine:
+			case inWord:
+				markWordEnd()
+				recordLine()
+			case outWord:
+				recordLine()
+			}
+			state = beforeLine
+		case c == '\t' || c == ' ':
+			switch state {
+			case beforeLine:
+			case outWord:
+			case inWord:
+				markWordEnd()
+				state = outWord
+			}
+		case isWordRune(c):
+			recordLetter(unicode.ToLower(c))
+			state = inWord
+		}
+	}
+}
+
+// CountText returns the ngrams of every length up to maxNgrams in text,
+// counted one length at a time in the same way as the corpus.
+func CountText(text []byte, maxNgrams int) map[string]int {
+	ngrams := make(map[string]int)
+	for n := 1; n <= maxNgrams; n++ {
+		// Reading from memory cannot fail.
+		Count(bytes.NewReader(text), ngrams, n, n)
+	}
+	return ngrams
+}
+
+// Write writes ngram counts to w in the sorted, tab-separated format read by
+// Find.
+func Write(w io.Writer, ngrams map[string]int) error {
+	var words []string
+	for s := range ngrams {
+		words = append(words, s)
+	}
+	sort.Strings(words)
+
+	b := bufio.NewWriter(w)
+	for _, s := range words {
+		fmt.Fprintf(b, "%v\t%v\n", s, ngrams[s])
+	}
+	return b.Flush()
+}
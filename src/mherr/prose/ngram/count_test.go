@@ -0,0 +1,74 @@
+package ngram
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		desc   string
+		input  string
+		max    int
+		filter int
+		want   map[string]int
+	}{
+		{
+			desc:  "single words",
+			input: "The cat. The dog.\n",
+			max:   1,
+			want:  map[string]int{"the": 2, "cat": 1, "dog": 1},
+		},
+		{
+			desc:   "ngrams stop at punctuation",
+			input:  "The cat sat, the end.\n",
+			max:    3,
+			filter: 3,
+			want:   map[string]int{"the cat sat": 1},
+		},
+		{
+			desc:   "pairs",
+			input:  "The cat sat, the end.\n",
+			max:    2,
+			filter: 2,
+			want:   map[string]int{"the cat": 1, "cat sat": 1, "the end": 1},
+		},
+		{
+			desc:  "accented letters",
+			input: "Renée met Zoë in Málaga.\n",
+			max:   1,
+			want:  map[string]int{"renée": 1, "met": 1, "zoë": 1, "in": 1, "málaga": 1},
+		},
+	}
+
+	for _, c := range tests {
+		got := make(map[string]int)
+		if err := Count(strings.NewReader(c.input), got, c.max, c.filter); err != nil {
+			t.Fatalf("test(%v): %v", c.desc, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("test(%v): got %v, want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var b bytes.Buffer
+	if err := Write(&b, map[string]int{"the cat": 2, "a": 5, "the": 10}); err != nil {
+		t.Fatal(err)
+	}
+	want := "a\t5\nthe\t10\nthe cat\t2\n"
+	if b.String() != want {
+		t.Fatalf("got %q, want %q", b.String(), want)
+	}
+}
+
+func TestCountText(t *testing.T) {
+	got := CountText([]byte("The cat sat.\n"), 2)
+	want := map[string]int{"the": 1, "cat": 1, "sat": 1, "the cat": 1, "cat sat": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,140 @@
+package ngram
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// Fragments of the last word shorter than minFuzzy runes are not
+	// corrected, since too many words are a few edits away from them.
+	minFuzzy = 3
+	// maxFuzzy is the number of corrections predicted for a fragment.
+	maxFuzzy = 5
+)
+
+// Typo is the factor by which the score of a corrected word is reduced for
+// each edit needed to correct the fragment typed.
+var Typo = 0.05
+
+// maxEdits returns the number of edits which may be made to correct a
+// fragment of the given length in runes.
+func maxEdits(n int) int {
+	switch {
+	case n < minFuzzy:
+		return 0
+	case n < 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// fragment returns the last, possibly incomplete, word of line.
+func fragment(line string) string {
+	return line[strings.LastIndexByte(line, ' ')+1:]
+}
+
+// fuzzy predicts the words which may have been meant by the last, misspelt
+// word of line. Words are found by scan, which calls fn with each word which
+// begins with a prefix until fn returns false, and total is the sum of the
+// frequencies of all the words. The predictions replace the misspelt word.
+//
+// Since a typo in the first letter of a word is rare, and searching all words
+// is slow, only words with the same first letter are considered. Even so, the
+// search stops when ctx is done, returning its error.
+func fuzzy(ctx context.Context, line string, total int, scan func(prefix string, fn func(text []byte, freq int) bool) error) (Matches, error) {
+	frag := fragment(line)
+	max := maxEdits(utf8.RuneCountInString(frag))
+	if max == 0 || total <= 0 {
+		return nil, nil
+	}
+	_, size := utf8.DecodeRuneInString(frag)
+	p := math.Pow(Backoff, float64(order(line)-1))
+
+	var ms Matches
+	err := scan(frag[:size], func(text []byte, freq int) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		word := string(text)
+		if strings.HasPrefix(word, frag) {
+			// Predicted without correction.
+			return true
+		}
+		d := prefixDistance(frag, word, max)
+		if d > max {
+			return true
+		}
+		ms = append(ms, Match{
+			Text:    word,
+			Freq:    freq,
+			Len:     1,
+			Score:   p * math.Pow(Typo, float64(d)) * float64(freq) / float64(total),
+			Replace: len(frag),
+		})
+		return true
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Stable(ms)
+	if len(ms) > maxFuzzy {
+		ms = ms[:maxFuzzy]
+	}
+	return ms, nil
+}
+
+// prefixDistance returns the least Levenshtein distance between frag and any
+// prefix of word, or a number greater than max if it is greater than max.
+func prefixDistance(frag, word string, max int) int {
+	a, b := []rune(frag), []rune(word)
+	// prev and cur are rows of the edit distances between prefixes of a,
+	// and each prefix of b.
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		least := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if cur[j] < least {
+				least = cur[j]
+			}
+		}
+		if least > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	least := prev[0]
+	for _, d := range prev {
+		if d < least {
+			least = d
+		}
+	}
+	return least
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
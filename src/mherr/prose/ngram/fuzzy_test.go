@@ -0,0 +1,91 @@
+package ngram
+
+import (
+	"arbovm/levenshtein"
+	"context"
+	"os"
+	"testing"
+)
+
+func TestPrefixDistance(t *testing.T) {
+	words := []string{"", "a", "the", "then", "there", "theory", "computer", "compute", "café"}
+	frags := []string{"a", "th", "teh", "thier", "compuetr", "cmoputer", "cafe"}
+	for _, frag := range frags {
+		for _, word := range words {
+			// The least distance to any prefix of the word.
+			want := len(frag)
+			for i := 0; i <= len(word); i++ {
+				if d := levenshtein.Distance(frag, word[:i]); d < want {
+					want = d
+				}
+			}
+			for max := 0; max <= 3; max++ {
+				got := prefixDistance(frag, word, max)
+				if want <= max && got != want || want > max && got <= max {
+					t.Fatalf("prefixDistance(%q, %q, %v): got %v, want %v", frag, word, max, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestFuzzy(t *testing.T) {
+	dir := corpus(t, map[string]string{
+		"ngrams.1.txt": "catalogue\t3\ncompute\t2\ncomputer\t10\ncorn\t5\n",
+	})
+	defer os.RemoveAll(dir)
+	f := NewFiles(dir)
+	defer f.Close()
+
+	tests := []struct {
+		line string
+		want Matches
+	}{
+		{"my compuetr", Matches{
+			{"computer", 10, 1, 0.4 * 0.05 * 0.05 * 10 / 20, len("compuetr")},
+			{"compute", 2, 1, 0.4 * 0.05 * 0.05 * 2 / 20, len("compuetr")},
+		}},
+		{"my cmo", Matches{
+			{"computer", 10, 1, 0.4 * 0.05 * 10 / 20, len("cmo")},
+			{"corn", 5, 1, 0.4 * 0.05 * 5 / 20, len("cmo")},
+			{"compute", 2, 1, 0.4 * 0.05 * 2 / 20, len("cmo")},
+		}},
+		// Too short to correct.
+		{"my cm", nil},
+	}
+	for _, c := range tests {
+		got, err := f.Predict(context.Background(), c.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameMatches(got, c.want) {
+			t.Fatalf("for %q, got %v, want %v", c.line, got, c.want)
+		}
+	}
+}
+
+func TestFuzzyDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var scanned []string
+	scan := func(prefix string, fn func(text []byte, freq int) bool) error {
+		for _, w := range []string{"computer", "compute", "corn"} {
+			scanned = append(scanned, w)
+			if w == "compute" {
+				cancel()
+			}
+			if !fn([]byte(w), 1) {
+				break
+			}
+		}
+		return nil
+	}
+
+	// The words are no longer scanned once ctx is done.
+	if ms, err := fuzzy(ctx, "my cmo", 10, scan); ms != nil || err != context.Canceled {
+		t.Fatalf("got %v, %v", ms, err)
+	}
+	if len(scanned) != 2 {
+		t.Fatalf("scanned %q", scanned)
+	}
+}
@@ -0,0 +1,215 @@
+package ngram
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DocumentWeight scales the scores of ngrams found in the document being
+// edited, relative to those in the corpus.
+var DocumentWeight = 2
+
+// Index is an in-memory ngram index of a document which is being edited. It
+// is also a Predictor.
+type Index struct {
+	mu sync.Mutex
+	// The number of times each paragraph appears in the document.
+	pars map[string]int
+	// The number of times each ngram appears in the document.
+	counts map[string]int
+	// The ngrams of each length, sorted. Ngrams whose count has fallen to
+	// zero are only removed when there are many of them.
+	sorted [MaxLength + 1][]string
+	unused int
+	// The sum of the counts of the ngrams of each length.
+	totals [MaxLength + 1]int
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{
+		pars:   make(map[string]int),
+		counts: make(map[string]int),
+	}
+}
+
+// Update sets the paragraphs of the document. Only the paragraphs which have
+// changed since the last update are counted again.
+func (ix *Index) Update(pars []string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	next := make(map[string]int)
+	for _, p := range pars {
+		next[p]++
+	}
+	for p, n := range ix.pars {
+		if diff := n - next[p]; diff > 0 {
+			ix.add(p, -diff)
+		}
+	}
+	for p, n := range next {
+		if diff := n - ix.pars[p]; diff > 0 {
+			ix.add(p, diff)
+		}
+	}
+	ix.pars = next
+	ix.tidy()
+}
+
+// Replace replaces one occurrence of paragraph from with to, counting only
+// the ngrams of those two paragraphs again.
+func (ix *Index) Replace(from, to string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if from == to {
+		return
+	}
+	if ix.pars[from] > 0 {
+		ix.add(from, -1)
+		if ix.pars[from]--; ix.pars[from] == 0 {
+			delete(ix.pars, from)
+		}
+	}
+	ix.add(to, 1)
+	ix.pars[to]++
+	ix.tidy()
+}
+
+// tidy compacts the sorted lists when many of their ngrams are unused.
+func (ix *Index) tidy() {
+	if ix.unused > len(ix.counts)/2+1000 {
+		ix.compact()
+	}
+}
+
+// add adds n times the ngrams of paragraph p to the index.
+func (ix *Index) add(p string, n int) {
+	for s, c := range CountText([]byte(p+"\n"), MaxLength) {
+		old := ix.counts[s]
+		ix.counts[s] += c * n
+		ix.totals[strings.Count(s, " ")+1] += c * n
+		switch {
+		case old == 0 && ix.counts[s] > 0:
+			if _, ok := ix.search(s); ok {
+				ix.unused--
+			} else {
+				ix.insert(s)
+			}
+		case old > 0 && ix.counts[s] <= 0:
+			delete(ix.counts, s)
+			ix.unused++
+		}
+	}
+}
+
+// search returns the position of s in its sorted list, and whether it is there.
+func (ix *Index) search(s string) (int, bool) {
+	l := ix.sorted[strings.Count(s, " ")+1]
+	i := sort.SearchStrings(l, s)
+	return i, i < len(l) && l[i] == s
+}
+
+// insert adds s to the sorted list of ngrams of its length.
+func (ix *Index) insert(s string) {
+	n := strings.Count(s, " ") + 1
+	i, _ := ix.search(s)
+	l := append(ix.sorted[n], "")
+	copy(l[i+1:], l[i:])
+	l[i] = s
+	ix.sorted[n] = l
+}
+
+// compact removes unused ngrams from the sorted lists.
+func (ix *Index) compact() {
+	for n, l := range ix.sorted {
+		var out []string
+		for _, s := range l {
+			if ix.counts[s] > 0 {
+				out = append(out, s)
+			}
+		}
+		ix.sorted[n] = out
+	}
+	ix.unused = 0
+}
+
+// Find returns the top ngrams of the given length which begin with prefix.
+func (ix *Index) Find(prefix string, length int) Matches {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if length < 1 || length > MaxLength {
+		return nil
+	}
+	l := ix.sorted[length]
+	ms := newTopMatches(Top)
+	for i := sort.SearchStrings(l, prefix); i < len(l) && strings.HasPrefix(l[i], prefix); i++ {
+		if n := ix.counts[l[i]]; n > 0 {
+			ms.insert(Match{Text: l[i], Freq: n, Len: length})
+		}
+	}
+	return ms.slice()
+}
+
+// Total returns the sum of the counts of the ngrams of the given length which
+// begin with prefix.
+func (ix *Index) Total(prefix string, length int) int {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if length < 1 || length > MaxLength {
+		return 0
+	}
+	if prefix == "" {
+		return ix.totals[length]
+	}
+	l := ix.sorted[length]
+	n := 0
+	for i := sort.SearchStrings(l, prefix); i < len(l) && strings.HasPrefix(l[i], prefix); i++ {
+		n += ix.counts[l[i]]
+	}
+	return n
+}
+
+// Predict implements Predictor.
+func (ix *Index) Predict(ctx context.Context, text string) (Matches, error) {
+	line := strings.ToLower(text)
+	if line == "" {
+		return nil, nil
+	}
+	var ms Matches
+	for l := MaxLength; l >= 1; l-- {
+		joined := lastN(line, l)
+		if strings.Trim(joined, " ") == "" {
+			continue
+		}
+		found := ix.Find(joined, l)
+		score(line, l, found, func(ctx string) (int, error) {
+			return ix.Total(ctx, l), nil
+		})
+		ms = append(ms, found...)
+	}
+	ms = complete(line, ms)
+	fixes, _ := fuzzy(ctx, line, ix.Total("", 1), ix.scanWords)
+	ms = append(ms, fixes...)
+	sort.Stable(ms)
+	return ms, nil
+}
+
+// scanWords calls fn with each word in the index which begins with prefix,
+// until fn returns false.
+func (ix *Index) scanWords(prefix string, fn func(text []byte, freq int) bool) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	l := ix.sorted[1]
+	for i := sort.SearchStrings(l, prefix); i < len(l) && strings.HasPrefix(l[i], prefix); i++ {
+		if n := ix.counts[l[i]]; n > 0 && !fn([]byte(l[i]), n) {
+			break
+		}
+	}
+	return nil
+}
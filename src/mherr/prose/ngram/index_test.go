@@ -0,0 +1,104 @@
+package ngram
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	ix := NewIndex()
+	ix.Update([]string{"Zarathustra spoke.", "Then Zarathustra left."})
+
+	tests := []struct {
+		prefix string
+		length int
+		want   Matches
+	}{
+		{"zara", 1, Matches{{"zarathustra", 2, 1, 0, 0}}},
+		{"then zara", 2, Matches{{"then zarathustra", 1, 2, 0, 0}}},
+		{"missing", 1, nil},
+	}
+	for _, c := range tests {
+		if got := ix.Find(c.prefix, c.length); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("Find(%q, %v): got %v, want %v", c.prefix, c.length, got, c.want)
+		}
+	}
+
+	// Changing one paragraph only changes its ngrams.
+	ix.Update([]string{"Zarathustra spoke.", "Then Zoroaster left."})
+	if got, want := ix.Find("zara", 1), (Matches{{"zarathustra", 1, 1, 0, 0}}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after update: got %v, want %v", got, want)
+	}
+	if got, want := ix.Find("zoro", 1), (Matches{{"zoroaster", 1, 1, 0, 0}}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after update: got %v, want %v", got, want)
+	}
+
+	// Replacing a paragraph does the same.
+	ix.Replace("Then Zoroaster left.", "Then Zarathustra left.")
+	if got, want := ix.Find("zara", 1), (Matches{{"zarathustra", 2, 1, 0, 0}}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after replace: got %v, want %v", got, want)
+	}
+	if got := ix.Find("zoro", 1); got != nil {
+		t.Fatalf("after replace: got %v", got)
+	}
+
+	ix.Update(nil)
+	if got := ix.Find("z", 1); got != nil {
+		t.Fatalf("after removing everything: got %v", got)
+	}
+}
+
+func TestIndexPhrases(t *testing.T) {
+	ix := NewIndex()
+	ix.Update([]string{"Once upon a time there was a king."})
+
+	ms, err := ix.Predict(context.Background(), "once upon ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, m := range ms {
+		texts = append(texts, m.Text)
+	}
+	want := []string{"a", "a time there", "a time"}
+	if !reflect.DeepEqual(texts, want) {
+		t.Fatalf("got %q, want %q", texts, want)
+	}
+
+	// Unlikely phrases are not predicted.
+	ix.Update([]string{"Once upon a time there was a king.", "Once upon a hill there stood a tree."})
+	defer func(s float64) { PhraseScore = s }(PhraseScore)
+	PhraseScore = 0.9
+	if ms, _ := ix.Predict(context.Background(), "once upon "); len(ms) != 1 {
+		t.Fatalf("got %v, want only the next words", ms)
+	}
+}
+
+func TestIndexAccents(t *testing.T) {
+	ix := NewIndex()
+	ix.Update([]string{"Renée met Zoë and Chloé in Málaga."})
+
+	tests := []struct {
+		prefix string
+		want   Matches
+	}{
+		{"ren", Matches{{"renée", 1, 1, 0, 0}}},
+		{"zo", Matches{{"zoë", 1, 1, 0, 0}}},
+		{"mál", Matches{{"málaga", 1, 1, 0, 0}}},
+	}
+	for _, c := range tests {
+		if got := ix.Find(c.prefix, 1); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Find(%q): got %v, want %v", c.prefix, got, c.want)
+		}
+	}
+
+	// Names are completed, not corrected.
+	ms, err := ix.Predict(context.Background(), "in Mál")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].Text != "aga" || ms[0].Replace != 0 {
+		t.Fatalf("got %v, want Málaga completed", ms)
+	}
+}
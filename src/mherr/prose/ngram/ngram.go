@@ -1,10 +1,13 @@
-// Package ngram locates entries in a plain-text ngram flat file.
+// Package ngram predicts text using ngrams, such as those in plain-text ngram
+// flat files.
 package ngram
 
 import (
 	"bytes"
+	"container/heap"
+	"container/list"
+	"context"
 	"fmt"
-	"io"
 	"mherr/prose/bsearch"
 	"os"
 	"path/filepath"
@@ -12,26 +15,58 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"unicode/utf8"
 )
 
 var ResourcePath = "../bin"
 
 var Debug = false
 
+// UseMmap memory-maps ngram databases where that is supported, rather than
+// reading them through a cache.
+var UseMmap = true
+
+// Top is the number of ngrams of each length predicted from each source, the
+// most frequent of those matching.
+var Top = 5
+
+// PhraseScore is the least score of an ngram for the rest of it to be
+// predicted as a phrase, as well as its next word.
+var PhraseScore = 0.25
+
+// MaxLength is the number of words in the longest ngrams.
+const MaxLength = 5
+
 const (
 	maxRecLength    = 1024
 	shortFragLength = 5
-	maxFreq         = 1<<63 - 1
+
+	// maxTotals is the number of context totals remembered by Files.
+	maxTotals = 10000
+	// cacheBlocks is the number of blocks of ngram files cached by Files.
+	cacheBlocks = 4096
 )
 
 type Match struct {
 	Text string
 	Freq int
 	Len  int
+	// The likelihood of the match, relative to others predicted for the same
+	// text, or zero if it has not been scored.
+	Score float64
+	// The number of bytes at the end of the text predicted for which Text is
+	// a replacement, such as a misspelt word. If zero, Text follows the text.
+	Replace int
+}
+
+// Phrase returns whether m predicts more than the next word.
+func (m Match) Phrase() bool {
+	return strings.Contains(strings.TrimLeft(m.Text, " "), " ")
 }
 
 func (m Match) String() string {
-	return fmt.Sprintf("text=%q freq=%v len=%v", m.Text, m.Freq, m.Len)
+	return fmt.Sprintf("text=%q freq=%v len=%v score=%.3g replace=%v", m.Text, m.Freq, m.Len, m.Score, m.Replace)
 }
 
 type record struct {
@@ -72,90 +107,186 @@ var cfg = bsearch.Config{
 		lrec := newRecord(l)
 		return bytes.Compare(lrec.Text, r) < 0
 	},
+	Prefix: func(rec, prefix []byte) bool {
+		return bytes.HasPrefix(newRecord(rec).Text, prefix)
+	},
 }
 
 // Find returns the top n matches from the database.
 func Find(filename, prefix string, length int) (Matches, error) {
-	f, err := os.Open(filename)
+	t, err := openDatabase(filename, nil)
 	if err != nil {
 		return nil, err
 	}
-	st, err := f.Stat()
+	defer t.close()
+	return find(t.db, prefix, length)
+}
+
+// Total returns the sum of the frequencies of the ngrams in the database which
+// begin with prefix.
+func Total(filename, prefix string) (int, error) {
+	t, err := openDatabase(filename, nil)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer f.Close()
+	defer t.close()
+	return total(t.db, prefix)
+}
 
-	var ms matchArray
+// WriteIndex writes a sparse index of every Kth ngram in a database alongside
+// it, which speeds up searches of the database by Files.
+func WriteIndex(filename string, every int) error {
+	return bsearch.WriteIndex(cfg, filename, every)
+}
 
-	// Find the last record earlier than the request. The next record will be >= our request.
-	sought := []byte(prefix)
-	r := bsearch.LowerBound(cfg, f, st.Size(), sought)
-	if r.Err == io.EOF {
-		return nil, nil
+func open(filename string) (*os.File, os.FileInfo, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
 	}
-	for {
-		// Find the one after.
-		nextOffset := r.End
-		r = bsearch.Read(cfg, f, nextOffset)
-		if r.Err == io.EOF {
-			break
-		}
-		if r.Err != nil {
-			return nil, r.Err
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, st, nil
+}
+
+// openDatabase opens an ngram database. It is memory-mapped if UseMmap is set
+// and that is supported, or else read through cache if that is not nil.
+// Files whose names end in binaryExt are in the binary format, and others
+// are flat files.
+func openDatabase(filename string, cache *bsearch.BlockCache) (*table, error) {
+	f, st, err := open(filename)
+	if err != nil {
+		return nil, err
+	}
+	t := &table{f: f}
+	var r bsearch.Reader = f
+	if UseMmap {
+		if m, err := bsearch.Mmap(f, st.Size()); err == nil {
+			// The mapping outlives the file.
+			f.Close()
+			t.f, t.m, r = nil, m, m
 		}
-		rec := newRecord(r.Data)
-		if !bytes.HasPrefix(rec.Text, sought) {
-			break
+	}
+	if t.m == nil && cache != nil {
+		r = cache.Reader(f, st.Size())
+	}
+	if strings.HasSuffix(filename, binaryExt) {
+		if t.db, err = newBinaryDatabase(r, st.Size()); err != nil {
+			t.close()
+			return nil, fmt.Errorf("%v: %v", filename, err)
 		}
-		m := Match{string(rec.Text), rec.Freq(), length}
-		ms.insert(m)
+		return t, nil
+	}
+	db := &textDatabase{cfg: cfg, r: r, size: st.Size()}
+	// Searches without the index when it is missing or stale.
+	db.cfg.Index, _ = bsearch.LoadIndex(filename, st)
+	t.db = db
+	return t, nil
+}
+
+func find(db database, prefix string, length int) (Matches, error) {
+	ms := newTopMatches(Top)
+	err := db.scan(prefix, func(text []byte, freq int) bool {
+		ms.insert(Match{Text: string(text), Freq: freq, Len: length})
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
 	return ms.slice(), nil
 }
 
-// matchArray is an efficient data structure to store the top 5 hits.
-type matchArray struct {
-	matches    [5]Match
-	lowest     int
-	lowestFreq int
+func total(db database, prefix string) (int, error) {
+	n := 0
+	err := db.scan(prefix, func(text []byte, freq int) bool {
+		n += freq
+		return true
+	})
+	return n, err
 }
 
-// insert adds a match to the array.
-func (a *matchArray) insert(v Match) {
-	if v.Freq <= a.lowestFreq {
-		return
-	}
+// database is a sorted ngram file which can be searched by prefix.
+type database interface {
+	// scan calls fn with each ngram which begins with prefix, in order,
+	// until fn returns false.
+	scan(prefix string, fn func(text []byte, freq int) bool) error
+}
 
-	a.matches[a.lowest] = v
+// textDatabase is a flat file of "text\tfreq\n" lines.
+type textDatabase struct {
+	cfg  bsearch.Config
+	r    bsearch.Reader
+	size int64
+}
 
-	// Find new lowest.
-	a.lowest = 0
-	a.lowestFreq = maxFreq
-	for i, x := range a.matches {
-		if x.Freq < a.lowestFreq {
-			a.lowest = i
-			a.lowestFreq = x.Freq
+func (db *textDatabase) scan(prefix string, fn func(text []byte, freq int) bool) error {
+	it := bsearch.PrefixRange(db.cfg, db.r, db.size, []byte(prefix), 0)
+	for it.Next() {
+		rec := newRecord(it.Record().Data)
+		if !fn(rec.Text, rec.Freq()) {
+			break
 		}
 	}
+	return it.Err()
 }
 
-// slice returns a slice of matches.
-func (a *matchArray) slice() Matches {
-	var ms Matches
-	for _, m := range a.matches {
-		if m.Freq > 0 {
-			ms = append(ms, m)
-		}
+// topMatches keeps the most frequent of the matches inserted into it.
+type topMatches struct {
+	n int
+	// A heap of the matches kept, the least frequent first.
+	h matchHeap
+}
+
+func newTopMatches(n int) *topMatches {
+	return &topMatches{n: n}
+}
+
+// insert adds a match, if it is among the n most frequent so far.
+func (t *topMatches) insert(v Match) {
+	switch {
+	case v.Freq <= 0 || t.n <= 0:
+	case len(t.h) < t.n:
+		heap.Push(&t.h, v)
+	case v.Freq > t.h[0].Freq:
+		t.h[0] = v
+		heap.Fix(&t.h, 0)
 	}
+}
+
+// slice returns the matches kept, best first.
+func (t *topMatches) slice() Matches {
+	if len(t.h) == 0 {
+		return nil
+	}
+	ms := append(Matches{}, t.h...)
 	sort.Sort(ms)
 	return ms
 }
 
+// matchHeap is a min-heap of matches by frequency.
+type matchHeap []Match
+
+func (h matchHeap) Len() int            { return len(h) }
+func (h matchHeap) Less(i, j int) bool  { return h[i].Freq < h[j].Freq }
+func (h matchHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *matchHeap) Push(x interface{}) { *h = append(*h, x.(Match)) }
+func (h *matchHeap) Pop() interface{} {
+	old := *h
+	m := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return m
+}
+
 type Matches []Match
 
 func (ms Matches) Len() int { return len(ms) }
 func (ms Matches) Less(i, j int) bool {
+	if ms[i].Score != ms[j].Score {
+		return ms[i].Score > ms[j].Score
+	}
 	if ms[i].Len > ms[j].Len {
 		return true
 	}
@@ -172,7 +303,7 @@ func (ms Matches) String() string {
 	var buf bytes.Buffer
 	buf.WriteString("\n")
 	for i, m := range ms {
-		buf.WriteString(fmt.Sprintf("%20q %7v\n", m.Text, m.Freq))
+		buf.WriteString(fmt.Sprintf("%20q %7v %9.3g\n", m.Text, m.Freq, m.Score))
 		if i > 5 {
 			buf.WriteString(fmt.Sprintf("%20v\n", "..."))
 			break
@@ -181,21 +312,37 @@ func (ms Matches) String() string {
 	return buf.String()
 }
 
+// Predictions returns the likely continuations of text from the ngram corpus
+// in ResourcePath.
 func Predictions(text string) (Matches, error) {
-	line := strings.ToLower(text)
-	ms, err := allMatches(line)
-	if err != nil {
-		return nil, err
-	}
+	f := NewFiles(ResourcePath)
+	defer f.Close()
+	return f.Predict(context.Background(), text)
+}
+
+// complete turns the ngrams matching line into the text which would complete
+// it, with the best ranked first. Likely enough ngrams are also predicted in
+// full, as phrases.
+func complete(line string, ms Matches) Matches {
+	var phrases Matches
 	for i := range ms {
+		if ms[i].Score >= PhraseScore {
+			p := ms[i]
+			p.Text = suffix(line, p.Text)
+			if p.Phrase() {
+				phrases = append(phrases, p)
+			}
+		}
 		ms[i].Text = findSuffix(line, ms[i].Text)
 	}
+	ms = append(ms, phrases...)
 
 	if Debug {
 		fmt.Printf("with suffix removed:%v\n", ms)
 	}
 
 	// Strip out duplicates.
+	sort.Stable(ms)
 	seen := make(map[string]bool)
 	var res Matches
 	for _, m := range ms {
@@ -213,23 +360,25 @@ func Predictions(text string) (Matches, error) {
 		fmt.Printf("with duplicates removed:%v", res)
 	}
 
-	return res, nil
+	return res
 }
 
-func matchLastN(line, filename string, length int) (Matches, error) {
+func (f *Files) matchLastN(line string, nf ngramFile) (Matches, error) {
 	var ms Matches
-	words := strings.Split(line, " ")
-	if len(words) > length {
-		words = words[len(words)-length:]
-	}
-	joined := strings.Join(words, " ")
+	joined := lastN(line, nf.l)
 
 	// Empty string is expensive to look up.
 	if strings.Trim(joined, " ") == "" {
 		return nil, nil
 	}
 
-	rec, err := Find(filename, joined, length)
+	t, err := f.table(nf)
+	if t == nil || err != nil {
+		return nil, err
+	}
+	defer t.users.Done()
+
+	rec, err := find(t.db, joined, nf.l)
 	if err != nil {
 		return nil, err
 	}
@@ -238,14 +387,284 @@ func matchLastN(line, filename string, length int) (Matches, error) {
 	}
 	ms = append(ms, rec...)
 
+	err = score(line, nf.l, ms, func(ctx string) (int, error) {
+		return f.total(t, ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	if Debug {
-		fmt.Printf("for %v %v-%v:%v", filename, length, ms)
+		fmt.Printf("for %v %v:%v", nf.filename, nf.l, ms)
+	}
+
+	return ms, nil
+}
+
+// table returns the open ngram file nf, which the caller must release by
+// calling users.Done. A missing optional file is nil. When the personal ngram
+// files have changed, every file is opened again.
+func (f *Files) table(nf ngramFile) (*table, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if gen := atomic.LoadInt64(&generation); f.tables == nil || f.gen != gen {
+		f.closeTables()
+		f.tables = make(map[string]*table)
+		f.totals = make(map[string]*list.Element)
+		f.lru = list.New()
+		f.gen = gen
+	}
+	t, ok := f.tables[nf.filename]
+	if !ok {
+		var err error
+		t, err = openDatabase(f.path(nf.filename), f.cache)
+		if err != nil && !(nf.optional && os.IsNotExist(err)) {
+			return nil, err
+		}
+		if t != nil {
+			t.name = nf.filename
+		}
+		f.tables[nf.filename] = t
+	}
+	if t != nil {
+		t.users.Add(1)
 	}
+	return t, nil
+}
+
+// closeTables closes the open files once they are no longer in use.
+func (f *Files) closeTables() {
+	for _, t := range f.tables {
+		if t != nil {
+			go func(t *table) {
+				t.users.Wait()
+				t.close()
+			}(t)
+		}
+	}
+	f.tables = nil
+}
+
+// Close closes the ngram files.
+func (f *Files) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closeTables()
+	return nil
+}
+
+// Stats returns the number of blocks of the ngram files which were found in
+// the cache, and the number which had to be read. Memory-mapped files
+// are not cached, so are not counted.
+func (f *Files) Stats() (hits, misses int64) {
+	return f.cache.Stats()
+}
+
+// total returns the sum of the frequencies of the ngrams in t which begin with
+// ctx. The most recently used totals are remembered, since the same context is
+// used to score predictions as each word is typed.
+func (f *Files) total(t *table, ctx string) (int, error) {
+	if ctx == "" {
+		return t.grandTotal()
+	}
+	key := t.name + "\t" + ctx
+	f.mu.Lock()
+	if e, ok := f.totals[key]; ok {
+		f.lru.MoveToFront(e)
+		n := e.Value.(*totalEntry).n
+		f.mu.Unlock()
+		return n, nil
+	}
+	f.mu.Unlock()
+
+	n, err := total(t.db, ctx)
+	if err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.totals[key]; !ok && f.tables[t.name] == t {
+		f.totals[key] = f.lru.PushFront(&totalEntry{key, n})
+		if f.lru.Len() > maxTotals {
+			last := f.lru.Back()
+			f.lru.Remove(last)
+			delete(f.totals, last.Value.(*totalEntry).key)
+		}
+	}
+	return n, nil
+}
+
+type totalEntry struct {
+	key string
+	n   int
+}
+
+// lastN returns the last length words of line.
+func lastN(line string, length int) string {
+	words := strings.Split(line, " ")
+	if len(words) > length {
+		words = words[len(words)-length:]
+	}
+	return strings.Join(words, " ")
+}
+
+// path returns the path of the named ngram file. A binary version of the file
+// is used in its place if there is one, unless it is older.
+func (f *Files) path(name string) string {
+	txt := filepath.Join(f.dir, name)
+	bin := BinaryName(txt)
+	bst, err := os.Stat(bin)
+	if err != nil {
+		return txt
+	}
+	if tst, err := os.Stat(txt); err == nil && tst.ModTime().After(bst.ModTime()) {
+		return txt
+	}
+	return bin
+}
+
+// table is an open ngram database.
+type table struct {
+	name string
+	// Either the open file, or its memory mapping.
+	f  *os.File
+	m  *bsearch.Mapped
+	db database
+	// The lookups which are using the file.
+	users sync.WaitGroup
+	// The sum of the frequencies of all its ngrams, counted once.
+	totalOnce sync.Once
+	total     int
+	totalErr  error
+}
+
+// grandTotal returns the sum of the frequencies of all the ngrams in t.
+func (t *table) grandTotal() (int, error) {
+	t.totalOnce.Do(func() {
+		t.total, t.totalErr = total(t.db, "")
+	})
+	return t.total, t.totalErr
+}
+
+func (t *table) close() error {
+	if t.m != nil {
+		return t.m.Close()
+	}
+	return t.f.Close()
+}
+
+// Files predicts text from the sorted ngram files in a directory, which may be
+// flat files or in the binary format.
+type Files struct {
+	dir   string
+	files []ngramFile
+	cache *bsearch.BlockCache
+
+	mu sync.Mutex
+	// The open files, and the most recently used totals of the contexts
+	// used to score predictions, as of the given generation of the personal
+	// ngram files.
+	tables map[string]*table
+	totals map[string]*list.Element
+	lru    *list.List
+	gen    int64
+}
+
+// NewFiles returns a Predictor for the ngram corpus in dir.
+func NewFiles(dir string) *Files {
+	return &Files{
+		dir:   dir,
+		cache: bsearch.NewBlockCache(cfg.ChunkSize, cacheBlocks),
+		files: []ngramFile{
+			{"ngrams.5.txt", 5, false, false},
+			{"ngrams.4.txt", 4, false, false},
+			{"ngrams.3.txt", 3, false, false},
+			{"ngrams.2.txt", 2, false, false},
+			{"ngrams.1.txt", 1, true, false},
+			{"ngrams.1.all.txt", 1, false, false},
+		},
+	}
+}
 
+// NewPersonal returns a Predictor for the ngrams learned from the user's own
+// writing in dir. See Learn.
+func NewPersonal(dir string) *Files {
+	f := &Files{dir: dir, cache: bsearch.NewBlockCache(cfg.ChunkSize, cacheBlocks)}
+	for l := MaxLength; l >= 1; l-- {
+		f.files = append(f.files, ngramFile{fmt.Sprintf(personalFile, l), l, l == 1, true})
+	}
+	return f
+}
+
+// Predict implements Predictor.
+func (f *Files) Predict(ctx context.Context, text string) (Matches, error) {
+	line := strings.ToLower(text)
+	// Corrections are looked for while the files are searched.
+	fixed := make(chan matchRes, 1)
+	go func() {
+		ms, err := f.corrections(ctx, line)
+		fixed <- matchRes{ms, err}
+	}()
+	ms, err := f.allMatches(ctx, line)
+	if err != nil {
+		return nil, err
+	}
+	ms = complete(line, ms)
+	fixes := <-fixed
+	switch {
+	case fixes.err == context.DeadlineExceeded:
+		// Out of time for corrections.
+	case fixes.err != nil:
+		return nil, fixes.err
+	default:
+		ms = append(ms, fixes.ms...)
+	}
+	sort.Stable(ms)
 	return ms, nil
 }
 
-func allMatches(line string) (Matches, error) {
+// corrections predicts corrections of the last word of line, from the files of
+// single words searched for short fragments. It stops when ctx is done,
+// returning its error.
+func (f *Files) corrections(ctx context.Context, line string) (Matches, error) {
+	if maxEdits(utf8.RuneCountInString(fragment(line))) == 0 {
+		return nil, nil
+	}
+	var res Matches
+	for _, nf := range f.files {
+		if nf.l != 1 || !nf.short {
+			continue
+		}
+		t, err := f.table(nf)
+		if t == nil || err != nil {
+			return nil, err
+		}
+		ms, err := f.fuzzy(ctx, t, line)
+		t.users.Done()
+		if err == context.DeadlineExceeded || err == context.Canceled {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", nf.filename, err)
+		}
+		res = append(res, ms...)
+	}
+	return res, nil
+}
+
+func (f *Files) fuzzy(ctx context.Context, t *table, line string) (Matches, error) {
+	n, err := f.total(t, "")
+	if err != nil {
+		return nil, err
+	}
+	return fuzzy(ctx, line, n, t.db.scan)
+}
+
+// allMatches searches every file for ngrams matching line. If ctx has a
+// deadline which passes before all the files are searched, it returns the
+// matches from those which were.
+func (f *Files) allMatches(ctx context.Context, line string) (Matches, error) {
 	line = strings.ToLower(line)
 
 	fail := func(err error) (Matches, error) {
@@ -253,35 +672,43 @@ func allMatches(line string) (Matches, error) {
 	}
 
 	short := len(line) < shortFragLength
-	files := []struct {
-		filename string
-		l        int
-		short    bool
-	}{
-		{"ngrams.5.txt", 5, false},
-		{"ngrams.4.txt", 4, false},
-		{"ngrams.3.txt", 3, false},
-		{"ngrams.2.txt", 2, false},
-		{"ngrams.1.txt", 1, true},
-		{"ngrams.1.all.txt", 1, false},
-	}
+	files := f.files
 
 	// Search all files in parallel.
-	var wg sync.WaitGroup
-	res := make([]matchRes, len(files))
+	type fileRes struct {
+		i int
+		matchRes
+	}
+	searched := make(chan fileRes, len(files))
+	waiting := 0
 	for index, file := range files {
 		i := index
-		f := file
-		if short && !f.short {
+		nf := file
+		if short && !nf.short {
 			continue
 		}
-		wg.Add(1)
+		waiting++
 		go func() {
-			res[i].ms, res[i].err = matchLastN(line, filepath.Join(ResourcePath, f.filename), f.l)
-			wg.Done()
+			ms, err := f.matchLastN(line, nf)
+			searched <- fileRes{i, matchRes{ms, err}}
 		}()
 	}
-	wg.Wait()
+
+	// If the deadline passes first, use the files which were searched in
+	// time.
+	res := make([]matchRes, len(files))
+wait:
+	for ; waiting > 0; waiting-- {
+		select {
+		case r := <-searched:
+			res[r.i] = r.matchRes
+		case <-ctx.Done():
+			break wait
+		}
+	}
+	if err := ctx.Err(); err != nil && err != context.DeadlineExceeded {
+		return nil, err
+	}
 
 	// But combine all their results deterministically in the original order.
 	var ms Matches
@@ -299,26 +726,41 @@ func allMatches(line string) (Matches, error) {
 	return ms, nil
 }
 
+// ngramFile describes an ngram file searched by Files.
+type ngramFile struct {
+	filename string
+	// The number of words in each ngram.
+	l int
+	// Whether to search the file for short fragments.
+	short bool
+	// Optional files may be missing.
+	optional bool
+}
+
 type matchRes struct {
 	ms  Matches
 	err error
 }
 
 func findSuffix(line, patch string) string {
+	// Only get the next word.
+	// Preserve leading space.
+	l := suffix(line, patch)
+	if len(l) > 2 {
+		i := strings.IndexRune(l[1:], ' ')
+		if i != -1 {
+			l = l[:i+1]
+		}
+	}
+	return l
+}
+
+// suffix returns the rest of patch after the end of line which it overlaps.
+func suffix(line, patch string) string {
 	for e := range line {
 		l := line[e:]
 		if strings.HasPrefix(patch, l) {
-
-			// Only get the next word.
-			// Preserve leading space.
-			l = strings.TrimPrefix(patch, l)
-			if len(l) > 2 {
-				i := strings.IndexRune(l[1:], ' ')
-				if i != -1 {
-					l = l[:i+1]
-				}
-			}
-			return l
+			return strings.TrimPrefix(patch, l)
 		}
 	}
 	return ""
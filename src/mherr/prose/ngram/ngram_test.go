@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -60,9 +61,9 @@ func TestFind(t *testing.T) {
 				"beaver\t5\n",
 			sought: "ac",
 			want: Matches{
-				{"acted", 30, 1},
-				{"acacia", 25, 1},
-				{"acorn", 20, 1},
+				{"acted", 30, 1, 0, 0},
+				{"acacia", 25, 1, 0, 0},
+				{"acorn", 20, 1, 0, 0},
 			},
 		},
 	}
@@ -89,6 +90,33 @@ func TestFind(t *testing.T) {
 	}
 }
 
+func TestTopMatches(t *testing.T) {
+	freqs := []int{3, 9, 0, 1, 7, 4, 9, 2, 8}
+	for n := 0; n <= len(freqs); n++ {
+		top := newTopMatches(n)
+		for i, f := range freqs {
+			top.insert(Match{Text: string(rune('a' + i)), Freq: f, Len: 1})
+		}
+		got := top.slice()
+
+		var want []int
+		sorted := append([]int{}, freqs...)
+		sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+		for _, f := range sorted {
+			if f > 0 && len(want) < n {
+				want = append(want, f)
+			}
+		}
+		var gotFreqs []int
+		for _, m := range got {
+			gotFreqs = append(gotFreqs, m.Freq)
+		}
+		if !reflect.DeepEqual(gotFreqs, want) {
+			t.Errorf("top %v: got %v, want frequencies %v", n, got, want)
+		}
+	}
+}
+
 func init() {
 	ResourcePath = "../bin"
 }
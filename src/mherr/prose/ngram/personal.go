@@ -0,0 +1,94 @@
+package ngram
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// personalFile is the name of the personal ngram file for each ngram length,
+// within ResourcePath.
+const personalFile = "personal.%v.txt"
+
+var learnMu sync.Mutex
+
+// generation is incremented whenever the personal ngram files change.
+var generation int64
+
+// Learn adds ngram counts, as produced by Count, to the personal ngram files
+// in ResourcePath. The files are kept in the same format as the corpus, so
+// they can be searched with Find.
+func Learn(ngrams map[string]int) error {
+	learnMu.Lock()
+	defer learnMu.Unlock()
+
+	byLength := make(map[int]map[string]int)
+	for s, n := range ngrams {
+		if n <= 0 {
+			continue
+		}
+		l := strings.Count(s, " ") + 1
+		if byLength[l] == nil {
+			byLength[l] = make(map[string]int)
+		}
+		byLength[l][s] += n
+	}
+
+	defer atomic.AddInt64(&generation, 1)
+	for l, add := range byLength {
+		filename := filepath.Join(ResourcePath, fmt.Sprintf(personalFile, l))
+		counts, err := readCounts(filename)
+		if err != nil {
+			return err
+		}
+		for s, n := range add {
+			counts[s] += n
+		}
+		if err := writeCounts(filename, counts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readCounts reads an ngram file into memory. A missing file has no ngrams.
+func readCounts(filename string) (map[string]int, error) {
+	counts := make(map[string]int)
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return counts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		rec := newRecord(append(s.Bytes(), '\n'))
+		if rec.Text != nil {
+			counts[string(rec.Text)] += rec.Freq()
+		}
+	}
+	return counts, s.Err()
+}
+
+// writeCounts replaces an ngram file.
+func writeCounts(filename string, counts map[string]int) error {
+	f, err := os.Create(filename + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err := Write(f, counts); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
@@ -0,0 +1,50 @@
+package ngram
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLearn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "Learn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	old := ResourcePath
+	ResourcePath = dir
+	defer func() { ResourcePath = old }()
+
+	for i := 0; i < 2; i++ {
+		if err := Learn(map[string]int{"prose": 1, "prose editor": 2, "zero": 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"personal.1.txt", "prose\t2\n"},
+		{"personal.2.txt", "prose editor\t4\n"},
+	}
+	for _, c := range tests {
+		got, err := ioutil.ReadFile(filepath.Join(dir, c.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != c.want {
+			t.Fatalf("%v: got %q, want %q", c.file, got, c.want)
+		}
+	}
+
+	ms, err := Find(filepath.Join(dir, "personal.2.txt"), "prose e", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].Text != "prose editor" {
+		t.Fatalf("Find: got %v", ms)
+	}
+}
@@ -0,0 +1,173 @@
+package ngram
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Predictor predicts the likely continuations of some text, best first.
+type Predictor interface {
+	Predict(ctx context.Context, text string) (Matches, error)
+}
+
+// PredictorFunc adapts a function to a Predictor.
+type PredictorFunc func(ctx context.Context, text string) (Matches, error)
+
+// Predict implements Predictor.
+func (f PredictorFunc) Predict(ctx context.Context, text string) (Matches, error) {
+	return f(ctx, text)
+}
+
+// Weighted is a Predictor whose frequencies and scores are scaled when blended.
+type Weighted struct {
+	Predictor
+	Weight int
+}
+
+// Blend returns a Predictor which combines the predictions of several
+// others, searched in parallel. When more than one predicts the same text,
+// the best ranked prediction is kept.
+func Blend(ps ...Weighted) Predictor {
+	return PredictorFunc(func(ctx context.Context, text string) (Matches, error) {
+		var wg sync.WaitGroup
+		res := make([]matchRes, len(ps))
+		for i := range ps {
+			wg.Add(1)
+			go func(i int) {
+				res[i].ms, res[i].err = ps[i].Predict(ctx, text)
+				wg.Done()
+			}(i)
+		}
+		wg.Wait()
+
+		var ms Matches
+		for i, r := range res {
+			if r.err != nil {
+				return nil, r.err
+			}
+			for _, m := range r.ms {
+				m.Freq *= ps[i].Weight
+				m.Score *= float64(ps[i].Weight)
+				ms = append(ms, m)
+			}
+		}
+		sort.Stable(ms)
+
+		type key struct {
+			text    string
+			replace int
+		}
+		seen := make(map[key]bool)
+		var out Matches
+		for _, m := range ms {
+			if k := (key{m.Text, m.Replace}); !seen[k] {
+				seen[k] = true
+				out = append(out, m)
+			}
+		}
+		return out, nil
+	})
+}
+
+// Filter returns a Predictor which only returns the predictions of p for
+// which keep returns true.
+func Filter(p Predictor, keep func(Match) bool) Predictor {
+	return PredictorFunc(func(ctx context.Context, text string) (Matches, error) {
+		ms, err := p.Predict(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		var out Matches
+		for _, m := range ms {
+			if keep(m) {
+				out = append(out, m)
+			}
+		}
+		return out, nil
+	})
+}
+
+// Deadline returns a Predictor which gives up on p after d. If p fails because
+// the deadline has passed, there are no predictions rather than an error.
+func Deadline(p Predictor, d time.Duration) Predictor {
+	return PredictorFunc(func(ctx context.Context, text string) (Matches, error) {
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+
+		ms, err := p.Predict(ctx, text)
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			return nil, nil
+		}
+		return ms, err
+	})
+}
+
+// Cache is a Predictor which remembers the most recent predictions of another.
+type Cache struct {
+	p    Predictor
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type cacheEntry struct {
+	text string
+	ms   Matches
+}
+
+// NewCache returns a Predictor which remembers up to size predictions of p.
+func NewCache(p Predictor, size int) *Cache {
+	return &Cache{
+		p:       p,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Predict implements Predictor.
+func (c *Cache) Predict(ctx context.Context, text string) (Matches, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[text]; ok {
+		c.lru.MoveToFront(e)
+		ms := e.Value.(*cacheEntry).ms
+		c.mu.Unlock()
+		return append(Matches{}, ms...), nil
+	}
+	c.mu.Unlock()
+
+	ms, err := c.p.Predict(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		// The predictions may be incomplete.
+		return ms, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[text]; !ok {
+		c.entries[text] = c.lru.PushFront(&cacheEntry{text, append(Matches{}, ms...)})
+		if c.lru.Len() > c.size {
+			last := c.lru.Back()
+			c.lru.Remove(last)
+			delete(c.entries, last.Value.(*cacheEntry).text)
+		}
+	}
+	return ms, nil
+}
+
+// Purge forgets all cached predictions, such as after the underlying ngrams
+// have changed.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
@@ -0,0 +1,285 @@
+package ngram
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fake returns fixed predictions, counting how often it is asked.
+type fake struct {
+	ms    Matches
+	calls int
+}
+
+func (f *fake) Predict(ctx context.Context, text string) (Matches, error) {
+	f.calls++
+	return append(Matches{}, f.ms...), nil
+}
+
+func TestBlend(t *testing.T) {
+	a := &fake{ms: Matches{{"cat", 10, 1, 0, 0}, {"dog", 5, 1, 0, 0}}}
+	b := &fake{ms: Matches{{"dog", 1, 1, 0, 0}, {"emu", 3, 2, 0, 0}}}
+	p := Blend(Weighted{a, 1}, Weighted{b, 10})
+
+	got, err := p.Predict(context.Background(), "the ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Matches{{"emu", 30, 2, 0, 0}, {"cat", 10, 1, 0, 0}, {"dog", 10, 1, 0, 0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	p := Filter(&fake{ms: Matches{{"cat", 10, 1, 0, 0}, {"dog", 5, 1, 0, 0}}}, func(m Match) bool {
+		return m.Text != "cat"
+	})
+	got, err := p.Predict(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Matches{{"dog", 5, 1, 0, 0}}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestCache(t *testing.T) {
+	f := &fake{ms: Matches{{"cat", 10, 1, 0, 0}}}
+	c := NewCache(f, 1)
+	ctx := context.Background()
+	for _, text := range []string{"a", "a", "b", "a"} {
+		if _, err := c.Predict(ctx, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.calls != 3 {
+		t.Fatalf("got %v calls, want 3", f.calls)
+	}
+	c.Purge()
+	c.Predict(ctx, "a")
+	if f.calls != 4 {
+		t.Fatalf("after Purge, got %v calls, want 4", f.calls)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	slow := PredictorFunc(func(ctx context.Context, text string) (Matches, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	got, err := Deadline(slow, time.Millisecond).Predict(context.Background(), "")
+	if err != nil || got != nil {
+		t.Fatalf("got %v, %v; want no predictions and no error", got, err)
+	}
+}
+
+// corpus writes a temporary ngram corpus, returning its directory.
+func corpus(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "Files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ngrams.1.txt", "ngrams.1.all.txt", "ngrams.2.txt", "ngrams.3.txt", "ngrams.4.txt", "ngrams.5.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(files[name]), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// sameMatches returns whether two lists of matches are the same, allowing for
+// rounding errors in their scores.
+func sameMatches(got, want Matches) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if math.Abs(g.Score-w.Score) > 1e-9 {
+			return false
+		}
+		g.Score, w.Score = 0, 0
+		if g != w {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFiles(t *testing.T) {
+	dir := corpus(t, map[string]string{
+		"ngrams.1.txt":     "cat\t10\ncatalogue\t3\n",
+		"ngrams.1.all.txt": "cat\t1\ncatalogue\t1\ncatamaran\t1\n",
+		"ngrams.2.txt":     "the cat\t7\nthe catalogue\t9\n",
+	})
+	defer os.RemoveAll(dir)
+
+	got, err := NewFiles(dir).Predict(context.Background(), "The cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Matches{{"alogue", 9, 2, 9.0 / 16, 0}, {"amaran", 1, 1, 0.4 / 3, 0}}
+	if !sameMatches(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// Personal files are optional.
+	got, err = NewPersonal(dir).Predict(context.Background(), "The cat")
+	if err != nil || got != nil {
+		t.Fatalf("got %v, %v; want no predictions and no error", got, err)
+	}
+}
+
+func TestFilesCache(t *testing.T) {
+	dir := corpus(t, nil)
+	defer os.RemoveAll(dir)
+	old := ResourcePath
+	ResourcePath = dir
+	defer func() { ResourcePath = old }()
+	// Memory-mapped files are not read through the cache.
+	UseMmap = false
+	defer func() { UseMmap = true }()
+
+	f := NewPersonal(dir)
+	defer f.Close()
+	ctx := context.Background()
+	if got, err := f.Predict(ctx, "catamaran"); err != nil || got != nil {
+		t.Fatalf("got %v, %v; want no predictions and no error", got, err)
+	}
+
+	// Learning reopens the personal files.
+	if err := Learn(map[string]int{"catamaran": 2}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Predict(ctx, "catam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Text != "aran" {
+		t.Fatalf("after Learn: got %v", got)
+	}
+
+	// Repeating a lookup is served from the cache.
+	_, before := f.Stats()
+	f.Predict(ctx, "catam")
+	if hits, misses := f.Stats(); hits == 0 || misses != before {
+		t.Fatalf("got %v hits and %v misses, want some hits and %v misses", hits, misses, before)
+	}
+}
+
+func TestFilesIndex(t *testing.T) {
+	dir := corpus(t, map[string]string{
+		"ngrams.1.txt":     "cat\t10\ncatalogue\t3\n",
+		"ngrams.1.all.txt": "cat\t1\ncatalogue\t1\ncatamaran\t1\n",
+		"ngrams.2.txt":     "the cat\t7\nthe catalogue\t9\n",
+	})
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"ngrams.1.txt", "ngrams.1.all.txt", "ngrams.2.txt"} {
+		if err := WriteIndex(filepath.Join(dir, name), 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A stale index is ignored.
+	if err := ioutil.WriteFile(filepath.Join(dir, "ngrams.2.txt"), []byte("the catalogue\t9\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFiles(dir)
+	defer f.Close()
+	got, err := f.Predict(context.Background(), "The cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Matches{{"alogue", 9, 2, 1, 0}, {"amaran", 1, 1, 0.4 / 3, 0}}
+	if !sameMatches(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestFilesTotals(t *testing.T) {
+	dir := corpus(t, map[string]string{
+		"ngrams.2.txt": "the cat\t3\nthe dog\t2\n",
+	})
+	defer os.RemoveAll(dir)
+	f := NewFiles(dir)
+	defer f.Close()
+	tb, err := f.table(ngramFile{"ngrams.2.txt", 2, false, false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tb.users.Done()
+
+	// The total of the whole file is counted once, apart from the others.
+	if n, err := f.total(tb, ""); n != 5 || err != nil {
+		t.Fatalf("got total %v, %v; want 5", n, err)
+	}
+	if len(f.totals) != 0 {
+		t.Fatalf("remembered %v totals", len(f.totals))
+	}
+
+	// The totals least recently used are forgotten first.
+	if n, err := f.total(tb, "the"); n != 5 || err != nil {
+		t.Fatalf("got total %v, %v; want 5", n, err)
+	}
+	for i := 0; i < maxTotals; i++ {
+		if i == maxTotals/2 {
+			f.total(tb, "the")
+		}
+		f.total(tb, fmt.Sprint(i))
+	}
+	if f.lru.Len() != maxTotals || len(f.totals) != maxTotals {
+		t.Fatalf("remembered %v totals, want %v", f.lru.Len(), maxTotals)
+	}
+	if _, ok := f.totals[tb.name+"\tthe"]; !ok {
+		t.Error("forgot a total used recently")
+	}
+	if _, ok := f.totals[tb.name+"\t0"]; ok {
+		t.Error("remembered the total used least recently")
+	}
+}
+
+func TestFilesDeadline(t *testing.T) {
+	dir := corpus(t, map[string]string{
+		"ngrams.1.txt": "cat\t10\ncatalogue\t3\n",
+	})
+	defer os.RemoveAll(dir)
+	f := NewFiles(dir)
+	defer f.Close()
+
+	// When the deadline has passed, the files searched in time are used.
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if _, err := f.Predict(ctx, "cat"); err != nil {
+		t.Fatalf("after the deadline: %v", err)
+	}
+
+	// Cancelled predictions fail.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.Predict(ctx, "cat"); err != context.Canceled {
+		t.Fatalf("after cancelling: got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestCacheIncomplete(t *testing.T) {
+	f := &fake{ms: Matches{{"cat", 10, 1, 0, 0}}}
+	c := NewCache(f, 10)
+
+	// Predictions made after the deadline may be incomplete, so are not
+	// remembered.
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	c.Predict(ctx, "a")
+	c.Predict(context.Background(), "a")
+	if f.calls != 2 {
+		t.Fatalf("got %v calls, want 2", f.calls)
+	}
+}
@@ -0,0 +1,44 @@
+package ngram
+
+import (
+	"math"
+	"strings"
+)
+
+// Backoff is the factor by which the score of a prediction is reduced for each
+// word of context dropped to find it, as in the "stupid backoff" scheme of
+// Brants et al, "Large Language Models in Machine Translation" (2007).
+var Backoff = 0.4
+
+// order returns the number of words of line which can be used to predict its
+// continuation.
+func order(line string) int {
+	n := strings.Count(line, " ") + 1
+	if n > MaxLength {
+		n = MaxLength
+	}
+	return n
+}
+
+// score sets the Score of ms, the ngrams of the given length which were found
+// for line. The score of an ngram is its frequency relative to all those in the
+// same file which share its context, that is the words of line preceding the
+// word being predicted. total returns the sum of the frequencies of the ngrams
+// which begin with a context.
+func score(line string, length int, ms Matches, total func(ctx string) (int, error)) error {
+	if len(ms) == 0 {
+		return nil
+	}
+	q := lastN(line, length)
+	ctx := q[:strings.LastIndexByte(q, ' ')+1]
+	n, err := total(ctx)
+	if err != nil || n <= 0 {
+		return err
+	}
+	k := strings.Count(q, " ") + 1
+	p := math.Pow(Backoff, float64(order(line)-k))
+	for i := range ms {
+		ms[i].Score = p * float64(ms[i].Freq) / float64(n)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package ngram
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestBackoff(t *testing.T) {
+	dir := corpus(t, map[string]string{
+		"ngrams.1.txt": "catalogue\t1\ncatamaran\t5\n",
+		"ngrams.2.txt": "the catalogue\t1\nthe cow\t99\n",
+	})
+	defer os.RemoveAll(dir)
+
+	// A common word is preferred to one rarely seen after "the", even though
+	// only the rare one was found with the longer context. Where a word is
+	// found with more than one context, its best score is kept.
+	got, err := NewFiles(dir).Predict(context.Background(), "the cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Matches{{"amaran", 5, 1, 0.4 * 5 / 6, 0}, {"alogue", 1, 1, 0.4 * 1 / 6, 0}}
+	if !sameMatches(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestIndexScores(t *testing.T) {
+	ix := NewIndex()
+	ix.Update([]string{"The cat sat.", "The cat ran.", "The dog sat."})
+
+	got, err := ix.Predict(context.Background(), "the cat ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Matches{{"ran", 1, 3, 1.0 / 2, 0}, {"sat", 1, 3, 1.0 / 2, 0}}
+	if !sameMatches(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,219 @@
+package view
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mherr/prose/diff"
+	"mherr/prose/ngram"
+	"mherr/prose/wordwrap"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrChanged is returned by Save when the file has been changed by another
+// program since it was loaded or saved. See Overwrite, Reload and Merge.
+var ErrChanged = errors.New("file changed on disk")
+
+// diskState is the state of the file on disk, when it was loaded or saved.
+type diskState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+	sum     [sha256.Size]byte
+}
+
+func newDiskState(data []byte, st os.FileInfo) diskState {
+	if st == nil {
+		return diskState{}
+	}
+	return diskState{true, st.Size(), st.ModTime(), sha256.Sum256(data)}
+}
+
+// sameStat returns whether st has the size and modification time recorded.
+func (s diskState) sameStat(st os.FileInfo) bool {
+	if st == nil {
+		return !s.exists
+	}
+	return s.exists && st.Size() == s.size && st.ModTime().Equal(s.modTime)
+}
+
+// onDisk returns the contents of the file, and whether they differ from
+// those last loaded or saved. A deleted file has no contents.
+func (d *Doc) onDisk() ([]byte, bool, error) {
+	st, err := os.Stat(d.filename)
+	if os.IsNotExist(err) {
+		return nil, d.disk.exists, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if d.disk.sameStat(st) {
+		return nil, false, nil
+	}
+	data, err := ioutil.ReadFile(d.filename)
+	if err != nil {
+		return nil, false, err
+	}
+	if d.disk.exists && sha256.Sum256(data) == d.disk.sum {
+		// Only touched.
+		d.disk = newDiskState(data, st)
+		return data, false, nil
+	}
+	return data, true, nil
+}
+
+// loaded records data as the contents of the file on disk.
+func (d *Doc) loaded(data []byte) {
+	st, err := os.Stat(d.filename)
+	if err != nil {
+		st = nil
+	}
+	d.disk = newDiskState(data, st)
+	d.base, _ = decode(data)
+	d.polled = d.disk
+}
+
+// Overwrite saves the document even if the file has changed on disk.
+func (d *Doc) Overwrite() error {
+	return d.save()
+}
+
+// Reload replaces the document with the file on disk, abandoning any unsaved
+// changes. It can be undone.
+func (d *Doc) Reload() error {
+	data, err := ioutil.ReadFile(d.filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	d.checkpoint(editOther)
+	text, format := decode(data)
+	d.setText(text)
+	d.format = format
+	d.dirty = false
+	d.loaded(data)
+	// The file was not written in the document, so is not learned from.
+	d.learned = ngram.CountText(data, ngram.MaxLength)
+	if err := d.removeSwap(); err != nil {
+		return err
+	}
+	d.Redraw()
+	return nil
+}
+
+// Merge merges the changes made to the file on disk with those made to the
+// document, paragraph by paragraph, since it was loaded or saved. Paragraphs
+// changed in both are kept in both versions, between conflict markers. It
+// returns the number of conflicts, and can be undone.
+func (d *Doc) Merge() (int, error) {
+	data, err := ioutil.ReadFile(d.filename)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	theirs, format := decode(data)
+	merged, conflicts := diff.Merge(
+		paragraphs(d.base),
+		paragraphs(d.layout.Unfold(d.lines)),
+		paragraphs(theirs),
+		"yours", "on disk")
+
+	text := strings.Join(merged, "\n")
+	if text != "" {
+		// Whether the file ends with a newline is kept by d.format.
+		text += "\n"
+	}
+
+	d.checkpoint(editOther)
+	d.setText([]byte(text))
+	d.format = format
+	d.dirty = true
+	d.loaded(data)
+	// Only the changes made in the document are learned when it is saved.
+	d.learned = ngram.CountText(data, ngram.MaxLength)
+	d.Redraw()
+	if conflicts > 0 {
+		d.WriteStatus(fmt.Sprintf("Merged with %v conflicts, marked with <<<<<<<.", conflicts))
+	} else {
+		d.WriteStatus("Merged.")
+	}
+	d.moveCursor()
+	return conflicts, nil
+}
+
+// paragraphs splits unfolded text into its lines, each a paragraph or the
+// blank line between paragraphs.
+func paragraphs(data []byte) []string {
+	s := strings.TrimSuffix(string(data), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// setText replaces the text of the document, and the layout it is saved in,
+// keeping the cursor within it.
+func (d *Doc) setText(data []byte) {
+	d.layout = wordwrap.Parse(string(data))
+	d.layout.Lists = d.opts.Markdown
+	d.lines = d.layout.Fold(d.textWidth())
+	if len(d.lines) == 0 {
+		d.lines = []string{""}
+	}
+	d.reindex = true
+	if d.y >= len(d.lines) {
+		d.y = len(d.lines) - 1
+	}
+	if d.x > len(d.lines[d.y]) {
+		d.x = len(d.lines[d.y])
+	}
+}
+
+// CheckDisk looks for changes made to the file by other programs since it
+// was last checked. An unchanged document is reloaded; otherwise the change
+// is reported, and dealt with when the document is saved. Failures are shown
+// in the status line, as well as returned.
+func (d *Doc) CheckDisk() error {
+	err := d.checkDisk()
+	if err != nil {
+		d.WriteStatus(fmt.Sprintf("Could not check %v: %v", filepath.Base(d.filename), err))
+		d.moveCursor()
+	}
+	return err
+}
+
+func (d *Doc) checkDisk() error {
+	st, err := os.Stat(d.filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err != nil {
+		st = nil
+	}
+	if d.polled.sameStat(st) {
+		return nil
+	}
+	data, changed, err := d.onDisk()
+	if err != nil {
+		return err
+	}
+	d.polled = newDiskState(data, st)
+	switch {
+	case !changed:
+	case st == nil:
+		d.WriteStatus(fmt.Sprintf("%v was deleted. Save to keep it.", filepath.Base(d.filename)))
+		d.moveCursor()
+	case !d.dirty:
+		if err := d.Reload(); err != nil {
+			return err
+		}
+		d.WriteStatus(fmt.Sprintf("Reloaded %v, which was changed on disk.", filepath.Base(d.filename)))
+		d.moveCursor()
+	default:
+		d.WriteStatus(fmt.Sprintf("%v was changed on disk. Saving will offer to merge.", filepath.Base(d.filename)))
+		d.moveCursor()
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package view
+
+import (
+	"io/ioutil"
+	"mherr/prose/ngram"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// changeOnDisk replaces the document's file, as another program would.
+func changeOnDisk(t *testing.T, d *Doc, data string) {
+	t.Helper()
+	if err := ioutil.WriteFile(d.filename, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the change can be seen, however coarse the file times.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(d.filename, later, later); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	d := testDoc(t, "one\n\ntwo\n", Options{})
+	typeText(t, d, "zero ")
+	changeOnDisk(t, d, "one\r\n\r\nthree\r\n")
+	if err := d.Save(); err != ErrChanged {
+		t.Fatalf("Save: got %v, want %v", err, ErrChanged)
+	}
+
+	if err := d.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	checkDoc(t, "reloaded", d, []string{"one", "", "three"}, 0, 3)
+	if d.Dirty() {
+		t.Error("the reloaded document is dirty")
+	}
+	if !d.format.crlf {
+		t.Error("the reloaded document does not have CRLF line endings")
+	}
+	if want := ngram.CountText([]byte("one\r\n\r\nthree\r\n"), ngram.MaxLength); !reflect.DeepEqual(d.learned, want) {
+		t.Errorf("got learned %v, want %v", d.learned, want)
+	}
+
+	d.Undo()
+	checkDoc(t, "undone", d, []string{"zero one", "", "two"}, 0, 5)
+}
+
+func TestCheckDisk(t *testing.T) {
+	d := testDoc(t, "one\n", Options{})
+	changeOnDisk(t, d, "two\n")
+	if err := d.CheckDisk(); err != nil {
+		t.Fatal(err)
+	}
+	// An unchanged document is reloaded.
+	checkDoc(t, "reloaded", d, []string{"two"}, 0, 0)
+
+	// A changed one is not.
+	typeText(t, d, "a ")
+	changeOnDisk(t, d, "three\n")
+	if err := d.CheckDisk(); err != nil {
+		t.Fatal(err)
+	}
+	checkDoc(t, "not reloaded", d, []string{"a two"}, 0, 2)
+}
+
+func TestMerge(t *testing.T) {
+	d := testDoc(t, "one\n\ntwo\n\nthree\n", Options{})
+	d.x = 3
+	typeText(t, d, "!")
+	changeOnDisk(t, d, "one\r\n\r\ntwo\r\n\r\nthree?\r\n")
+
+	conflicts, err := d.Merge()
+	if err != nil || conflicts != 0 {
+		t.Fatalf("got %v conflicts, %v", conflicts, err)
+	}
+	if got, want := d.lines, []string{"one!", "", "two", "", "three?"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if want := ngram.CountText([]byte("one\r\n\r\ntwo\r\n\r\nthree?\r\n"), ngram.MaxLength); !reflect.DeepEqual(d.learned, want) {
+		t.Errorf("got learned %v, want %v", d.learned, want)
+	}
+
+	// The merge is saved with the line endings of the file on disk.
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(d.filename); string(data) != "one!\r\n\r\ntwo\r\n\r\nthree?\r\n" {
+		t.Errorf("saved %q", data)
+	}
+
+	// Paragraphs changed in both are kept in both versions.
+	d.y, d.x = 2, 3
+	typeText(t, d, "!")
+	changeOnDisk(t, d, "one!\n\ntwo?\n\nthree?\n")
+	conflicts, err = d.Merge()
+	if err != nil || conflicts != 1 {
+		t.Fatalf("got %v conflicts, %v", conflicts, err)
+	}
+	want := []string{"one!", "", "<<<<<<< yours", "", "two!", "", "=======", "", "two?", "", ">>>>>>> on disk", "", "three?"}
+	if !reflect.DeepEqual(d.lines, want) {
+		t.Errorf("got %q, want %q", d.lines, want)
+	}
+	if d.format.crlf {
+		t.Error("the merge has CRLF line endings, unlike the file")
+	}
+
+	d.Undo()
+	if got, want := d.lines, []string{"one!", "", "two!", "", "three?"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("undone: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+package view
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+)
+
+// format is how a file's text is laid out, kept when it is saved.
+type format struct {
+	// Whether lines end with "\r\n" rather than "\n".
+	crlf bool
+	// Whether the last line ends with a line ending.
+	finalNewline bool
+}
+
+// newFormat is the format of new files.
+var newFormat = format{finalNewline: true}
+
+// decode returns the text of a file with "\n" line endings, and its format.
+func decode(data []byte) ([]byte, format) {
+	if len(data) == 0 {
+		return data, newFormat
+	}
+	f := format{
+		// Files with a mixture are saved with the more common ending.
+		crlf:         bytes.Count(data, []byte("\r\n"))*2 > bytes.Count(data, []byte("\n")),
+		finalNewline: data[len(data)-1] == '\n',
+	}
+	return bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1), f
+}
+
+// encode returns text, with "\n" line endings, as the contents of a file in
+// format f.
+func (f format) encode(text []byte) []byte {
+	if !f.finalNewline {
+		text = bytes.TrimSuffix(text, []byte("\n"))
+	}
+	if f.crlf {
+		text = bytes.Replace(text, []byte("\n"), []byte("\r\n"), -1)
+	}
+	return text
+}
+
+// writeFile durably replaces the contents of a file with data, by writing a
+// temporary file and renaming it over the file. A symlink is followed, so that
+// its target is replaced rather than the link, and the file keeps its
+// permissions. New files are created with perm, less the umask.
+func writeFile(filename string, data []byte, perm os.FileMode) error {
+	if target, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = target
+	}
+	st, err := os.Stat(filename)
+	if err == nil {
+		perm = st.Mode().Perm()
+	}
+	tmp := filename + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return fail(err)
+	}
+	if st != nil {
+		// Not limited by the umask, unlike OpenFile.
+		if err := f.Chmod(perm); err != nil {
+			return fail(err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(filename))
+}
+
+// syncDir flushes a directory to disk, making renames within it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
@@ -0,0 +1,109 @@
+package view
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		data, text string
+		f          format
+	}{
+		{"", "", newFormat},
+		{"a\nb\n", "a\nb\n", format{finalNewline: true}},
+		{"a\nb", "a\nb", format{}},
+		{"a\r\nb\r\n", "a\nb\n", format{crlf: true, finalNewline: true}},
+		{"a\r\nb", "a\nb", format{crlf: true}},
+	}
+	for _, c := range tests {
+		text, f := decode([]byte(c.data))
+		if string(text) != c.text || f != c.f {
+			t.Errorf("decode(%q): got %q, %+v, want %q, %+v", c.data, text, f, c.text, c.f)
+		}
+		if got := f.encode(text); string(got) != c.data {
+			t.Errorf("encode(%q): got %q, want %q", text, got, c.data)
+		}
+	}
+
+	// Files with a mixture of line endings are saved with the more common.
+	if _, f := decode([]byte("a\r\nb\r\nc\n")); !f.crlf {
+		t.Error("got LF line endings for a file mostly with CRLF")
+	}
+	if _, f := decode([]byte("a\r\nb\nc\n")); f.crlf {
+		t.Error("got CRLF line endings for a file mostly with LF")
+	}
+}
+
+func TestSaveFormat(t *testing.T) {
+	d := testDoc(t, "one\r\n\r\ntwo", Options{})
+	typeText(t, d, "zero ")
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(d.filename); string(data) != "zero one\r\n\r\ntwo" {
+		t.Errorf("saved %q", data)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file")
+
+	// Existing files keep their permissions.
+	if err := ioutil.WriteFile(name, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(name, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(name, []byte("new"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != "new" {
+		t.Errorf("got %q", data)
+	}
+	checkPerm(t, name, 0640)
+
+	// The target of a symlink is replaced, not the link.
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink("file", link); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(link, []byte("linked"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := os.Lstat(link); err != nil {
+		t.Error(err)
+	} else if st.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("the link was replaced: got mode %v", st.Mode())
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != "linked" {
+		t.Errorf("got %q in the target", data)
+	}
+
+	// New files are created with the permissions given.
+	created := filepath.Join(dir, "new")
+	if err := writeFile(created, []byte("created"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	checkPerm(t, created, 0600)
+
+	// No temporary files are left behind.
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(files) > 0 {
+		t.Errorf("left %v", files)
+	}
+}
+
+func checkPerm(t *testing.T, name string, want os.FileMode) {
+	t.Helper()
+	st, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode().Perm() != want {
+		t.Errorf("%v: got mode %v, want %v", filepath.Base(name), st.Mode().Perm(), want)
+	}
+}
@@ -0,0 +1,241 @@
+package view
+
+import (
+	"mherr/prose/wordwrap"
+	"strconv"
+	"strings"
+)
+
+const (
+	headingStyle  = "1m"  // Bold
+	strongStyle   = "1m"  // Bold
+	emphasisStyle = "3m"  // Italic
+	codeStyle     = "36m" // Cyan
+)
+
+// inCode returns whether line y is fenced code, in Markdown mode.
+func (d *Doc) inCode(y int) bool {
+	if d.opts.Markdown && len(d.code) != len(d.lines) {
+		d.findCode()
+	}
+	return y < len(d.code) && d.code[y]
+}
+
+// findCode finds the lines which are fenced code, in Markdown mode. As each
+// change to the text is redrawn, it is called by Redraw.
+func (d *Doc) findCode() {
+	d.code = nil
+	if d.opts.Markdown {
+		d.code = wordwrap.InCode(d.lines)
+	}
+}
+
+// predicting returns whether text typed at the cursor is predicted. Code is
+// not, so that keys which accept predictions can be typed in it.
+func (d *Doc) predicting() bool {
+	return d.auto && !d.inCode(d.y)
+}
+
+// markdownSpans returns the styled portions of line y in Markdown mode:
+// headings, emphasis and code. Emphasis and code spans are only found
+// within a line.
+func (d *Doc) markdownSpans(y int) []span {
+	if !d.opts.Markdown {
+		return nil
+	}
+	l := d.lines[y]
+	switch {
+	case d.inCode(y):
+		return []span{{0, len(l), codeStyle}}
+	case heading(l) && (y == 0 || d.lines[y-1] == ""):
+		return []span{{0, len(l), headingStyle}}
+	}
+	return inlineSpans(l)
+}
+
+// heading returns whether l is an ATX heading, such as "## Heading".
+func heading(l string) bool {
+	n := len(l) - len(strings.TrimLeft(l, "#"))
+	return n >= 1 && n <= 6 && (n == len(l) || l[n] == ' ')
+}
+
+// inlineSpans returns the code spans, strong emphasis and emphasis in l.
+func inlineSpans(l string) []span {
+	var res []span
+	for i := 0; i < len(l); {
+		c := l[i]
+		switch c {
+		case '\\':
+			i += 2
+			continue
+		case '`', '*', '_':
+		default:
+			i++
+			continue
+		}
+		run := len(l[i:]) - len(strings.TrimLeft(l[i:], string(c)))
+		delim := l[i : i+run]
+		if c == '`' {
+			end := closing(l, i+run, delim, false)
+			if end < 0 {
+				i += run
+				continue
+			}
+			res = append(res, span{i, end + run, codeStyle})
+			i = end + run
+			continue
+		}
+		if run > 2 {
+			run, delim = 2, delim[:2]
+		}
+		// The text emphasised cannot start with a space, nor can an
+		// underscore start within a word.
+		if i+run == len(l) || l[i+run] == ' ' || c == '_' && i > 0 && isWordByte(l[i-1]) {
+			i += run
+			continue
+		}
+		end := closing(l, i+run, delim, true)
+		if end < 0 {
+			i += run
+			continue
+		}
+		style := emphasisStyle
+		if run == 2 {
+			style = strongStyle
+		}
+		res = append(res, span{i, end + run, style})
+		i += run
+	}
+	return res
+}
+
+// closing returns the offset of the delimiter closing a span opened before
+// offset i, or -1 if there is none. Emphasis cannot end with a space, and
+// its delimiter cannot be part of a longer run.
+func closing(l string, i int, delim string, emphasis bool) int {
+	for i < len(l) {
+		j := strings.Index(l[i:], delim)
+		if j < 0 {
+			return -1
+		}
+		j += i
+		end := j + len(delim)
+		longer := end < len(l) && l[end] == delim[0] || l[j-1] == delim[0]
+		if !longer && (!emphasis || l[j-1] != ' ') {
+			return j
+		}
+		i = end
+		for i < len(l) && l[i] == delim[0] {
+			i++
+		}
+	}
+	return -1
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// item returns the first line of the list item containing line y, in
+// Markdown mode. The lines after the first have a hanging indent.
+func (d *Doc) item(y int) (int, bool) {
+	if !d.opts.Markdown {
+		return 0, false
+	}
+	for ; y >= 0; y-- {
+		l := d.lines[y]
+		if wordwrap.ListMarker(l) > 0 {
+			return y, true
+		}
+		if !preformatted(l) {
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// hang returns the hanging indent of the lines of the list item containing
+// line y, or "" if it is not in one.
+func (d *Doc) hang(y int) string {
+	start, ok := d.item(y)
+	if !ok {
+		return ""
+	}
+	return strings.Repeat(" ", wordwrap.ListMarker(d.lines[start]))
+}
+
+// enterItem starts a new list item at the cursor, if it is in one, with the
+// same bullet and indent, or the next number. Entering on an empty item ends
+// the list instead. It returns false if the cursor is not in a list item.
+func (d *Doc) enterItem() bool {
+	start, ok := d.item(d.y)
+	if !ok {
+		return false
+	}
+	d.checkpoint(editOther)
+	d.dirty = true
+
+	first := d.lines[start]
+	n := wordwrap.ListMarker(first)
+	if start == d.y && strings.TrimSpace(first[n:]) == "" {
+		d.lines[d.y], d.x = "", 0
+		d.Redraw()
+		d.hidePredictions()
+		return true
+	}
+
+	here := d.lines[d.y]
+	x := d.x
+	if x < n {
+		// Within the bullet or hanging indent.
+		x = n
+	}
+	if x > len(here) {
+		x = len(here)
+	}
+	before := here[:x]
+	if t := strings.TrimRight(before, " "); len(t) > n {
+		before = t
+	}
+	marker := nextMarker(first[:n])
+	out := append([]string{}, d.lines[:d.y]...)
+	out = append(out, before, marker+strings.TrimLeft(here[x:], " "))
+	out = append(out, d.lines[d.y+1:]...)
+	d.lines = out
+	d.y++
+	d.x = len(marker)
+	d.reflow()
+	d.Redraw()
+	d.showPredictions()
+	return true
+}
+
+// nextMarker returns the bullet of the list item after one with the given
+// bullet: the same bullet, or the next number.
+func nextMarker(marker string) string {
+	s := strings.TrimLeft(marker, " ")
+	indent := marker[:len(marker)-len(s)]
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return marker
+	}
+	n, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return marker
+	}
+	return indent + strconv.Itoa(n+1) + s[i:]
+}
+
+// startsParagraph returns whether words carried by reflow from a paragraph
+// with the given hanging indent cannot join line y, in Markdown mode:
+// because it starts a list item, or is not a line of the same item.
+func (d *Doc) startsParagraph(y int, hang string) bool {
+	if !d.opts.Markdown {
+		return false
+	}
+	l := d.lines[y]
+	return wordwrap.ListMarker(l) > 0 || hang != "" && !strings.HasPrefix(l, hang)
+}
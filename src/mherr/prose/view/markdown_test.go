@@ -0,0 +1,126 @@
+package view
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnterItem(t *testing.T) {
+	tests := []struct {
+		desc  string
+		text  string
+		y, x  int
+		lines []string
+		cy    int
+		cx    int
+	}{
+		{"bullet", "- one\n", 0, 5, []string{"- one", "- "}, 1, 2},
+		{"number", "1. one\n", 0, 6, []string{"1. one", "2. "}, 1, 3},
+		{"indented", "  * one\n", 0, 7, []string{"  * one", "  * "}, 1, 4},
+		{"split", "- one two\n", 0, 6, []string{"- one", "- two"}, 1, 2},
+		{"empty item ends the list", "- one\n- \n", 1, 2, []string{"- one", ""}, 1, 0},
+		{"not in a list", "one\n", 0, 3, []string{"one", "", ""}, 2, 0},
+	}
+	for _, c := range tests {
+		d := testDoc(t, c.text, Options{Markdown: true})
+		d.y, d.x = c.y, c.x
+		d.Enter()
+		checkDoc(t, c.desc, d, c.lines, c.cy, c.cx)
+	}
+}
+
+func TestHangingIndent(t *testing.T) {
+	d := testDoc(t, "- x\n", Options{Markdown: true})
+	d.x = 3
+	words := strings.Repeat(" word", 30)
+	typeText(t, d, words)
+	if len(d.lines) < 2 {
+		t.Fatalf("not wrapped: %q", d.lines)
+	}
+	for i, l := range d.lines {
+		if i > 0 && !strings.HasPrefix(l, "  word") {
+			t.Errorf("line %v has no hanging indent: %q", i, l)
+		}
+		if len(l) >= d.textWidth() {
+			t.Errorf("line %v is too wide: %q", i, l)
+		}
+	}
+	ps := d.paragraphs()
+	if len(ps) != 1 || ps[0].text != "- x"+words {
+		t.Errorf("got paragraphs %+v", ps)
+	}
+
+	// Erasing words brings the next line's back, without its indent.
+	d.y, d.x = 0, 3
+	for i := 0; i < len(" word word"); i++ {
+		d.Delete()
+	}
+	ps = d.paragraphs()
+	if len(ps) != 1 || ps[0].text != "- x"+words[len(" word word"):] {
+		t.Errorf("after deleting: got paragraphs %+v", ps)
+	}
+	for i, l := range d.lines {
+		if i > 0 && !strings.HasPrefix(l, "  word") {
+			t.Errorf("after deleting: line %v has no hanging indent: %q", i, l)
+		}
+	}
+
+	// Saved, the item is unfolded.
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(d.layout.Unfold(d.lines)), "- x"+words[len(" word word"):]+"\n"; got != want {
+		t.Errorf("saved %q, want %q", got, want)
+	}
+}
+
+func TestMarkdownCode(t *testing.T) {
+	d := testDoc(t, "# Title\n\ntext\n\n```\ncode\n```\n", Options{Markdown: true})
+	d.auto = true
+	d.Redraw()
+	var code []bool
+	for y := range d.lines {
+		code = append(code, d.inCode(y))
+	}
+	if want := []bool{false, false, false, false, true, true, true}; !reflect.DeepEqual(code, want) {
+		t.Errorf("got %v, want %v", code, want)
+	}
+	for _, y := range []int{2, 5} {
+		d.y = y
+		if got, want := d.predicting(), y == 2; got != want {
+			t.Errorf("line %v: predicting %v, want %v", y, got, want)
+		}
+	}
+
+	// Code is found again after edits. Without its opening fence, the
+	// closing one opens a block.
+	d.y, d.x = 4, 0
+	d.Delete()
+	if d.inCode(4) || !d.inCode(len(d.lines)-1) {
+		t.Errorf("after removing the fence: got %v in %q", d.code, d.lines)
+	}
+
+	if got, want := fmt.Sprint(d.markdownSpans(0)), fmt.Sprint([]span{{0, 7, headingStyle}}); got != want {
+		t.Errorf("got heading spans %v, want %v", got, want)
+	}
+}
+
+func TestInlineSpans(t *testing.T) {
+	tests := []struct {
+		line string
+		want []span
+	}{
+		{"*em* and **strong**", []span{{0, 4, emphasisStyle}, {9, 19, strongStyle}}},
+		{"`code *not em*`", []span{{0, 15, codeStyle}}},
+		{"snake_case_name", nil},
+		{"a * b * c", nil},
+		{`\*escaped*`, nil},
+	}
+	for _, c := range tests {
+		if got := inlineSpans(c.line); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("inlineSpans(%q): got %v, want %v", c.line, got, c.want)
+		}
+	}
+}
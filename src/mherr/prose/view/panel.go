@@ -0,0 +1,293 @@
+package view
+
+import (
+	"fmt"
+	"mherr/prose/ngram"
+	"mherr/prose/wordwrap"
+	"strings"
+)
+
+// Panel is where predictions are shown.
+type Panel int
+
+const (
+	// PanelBottom shows predictions at the bottom of the screen, above the
+	// status line.
+	PanelBottom Panel = iota
+	// PanelPopup shows predictions over the text next to the cursor, below
+	// it if they fit.
+	PanelPopup
+	// PanelInline shows the best prediction as ghost text after the cursor.
+	// Only Tab and Right accept it.
+	PanelInline
+)
+
+const (
+	// defaultPanelHeight is the number of predictions shown if
+	// Options.PanelHeight is zero.
+	defaultPanelHeight = 8
+	// defaultKeys accept the predictions shown if Options.Keys is empty.
+	defaultKeys = ";1234567"
+
+	popupStyle = "7m" // Reverse video
+	ghostStyle = "2m" // Dim
+)
+
+// ParsePanel returns the Panel with the given name: "bottom", "popup" or
+// "inline".
+func ParsePanel(name string) (Panel, error) {
+	switch name {
+	case "bottom":
+		return PanelBottom, nil
+	case "popup":
+		return PanelPopup, nil
+	case "inline":
+		return PanelInline, nil
+	}
+	return 0, fmt.Errorf("unknown prediction panel %q", name)
+}
+
+// keys returns the keys which accept each prediction shown, in order.
+func (d *Doc) keys() string {
+	if d.opts.Keys != "" {
+		return d.opts.Keys
+	}
+	return defaultKeys
+}
+
+// acceptKey returns the index of the prediction accepted by r, if it is an
+// accept key, or -1 if there is nothing to accept. Tab always accepts the
+// first, or the ghost text.
+func (d *Doc) acceptKey(r rune) (int, bool) {
+	if !d.predicting() {
+		return 0, false
+	}
+	if d.opts.Panel == PanelInline {
+		return d.ghost, r == '\t'
+	}
+	if r == '\t' {
+		return 0, true
+	}
+	i := strings.IndexRune(d.keys(), r)
+	if i < 0 {
+		return 0, false
+	}
+	return len([]rune(d.keys()[:i])), true
+}
+
+// panelHeight returns the number of predictions shown.
+func (d *Doc) panelHeight() int {
+	if d.opts.PanelHeight > 0 {
+		return d.opts.PanelHeight
+	}
+	return defaultPanelHeight
+}
+
+// drawPredictions draws d.predictions in the panel.
+func (d *Doc) drawPredictions() {
+	line := d.lines[d.y][:d.x]
+	ws := strings.Split(line, " ")
+	lastWord := ws[len(ws)-1]
+	keys := []rune(d.keys())
+
+	var entries []string
+	for i := 0; i < d.panelHeight() && i < len(d.predictions); i++ {
+		m := d.predictions[i]
+		// Corrections of the last word are marked, but not changes of case.
+		stem, marker := lastWord, ""
+		if m.Replace > 0 && m.Replace <= len(stem) {
+			old := stem[len(stem)-m.Replace:]
+			if !strings.HasPrefix(strings.ToLower(m.Text), strings.ToLower(old)) {
+				marker = "~"
+			}
+			stem = stem[:len(stem)-m.Replace]
+		}
+		key := " "
+		if i < len(keys) {
+			key = string(keys[i])
+		}
+		s := fmt.Sprintf("%v %v%v%v", key, marker, stem, m.Text)
+		if d.opts.ShowScores {
+			s += fmt.Sprintf("  %.3g", m.Score)
+		}
+		entries = append(entries, s)
+	}
+
+	switch d.opts.Panel {
+	case PanelPopup:
+		d.drawPopup(entries)
+	case PanelInline:
+		d.drawGhost()
+	default:
+		for i := 0; i < d.predictionsHeight(); i++ {
+			var s string
+			if i < len(entries) {
+				s = entries[i]
+			}
+			d.drawLine(d.predictionsY()+i, s)
+		}
+	}
+	d.moveCursor()
+}
+
+// drawPopup draws entries in a box next to the cursor, over the text below
+// it, or above it if there is no room below. Only the text under the box is
+// covered.
+func (d *Doc) drawPopup(entries []string) {
+	d.clearOverlay()
+	if len(entries) == 0 {
+		return
+	}
+
+	w := 0
+	for i, s := range entries {
+		// Leave room for the box's margin.
+		if max := d.textWidth() - 2; wordwrap.Width(s) > max {
+			entries[i] = s[:wordwrap.Offset(s, max)]
+		}
+		if sw := wordwrap.Width(entries[i]); sw > w {
+			w = sw
+		}
+	}
+	col := d.col() - d.viewX
+	if col+w+2 > d.textWidth() {
+		col = d.textWidth() - w - 2
+	}
+
+	cy := d.y - d.viewY + 1
+	y := cy + 1
+	if y+len(entries) > d.statusBarY() {
+		y = cy - len(entries)
+	}
+	if y < 1 {
+		y = 1
+	}
+
+	for i, s := range entries {
+		if y+i == cy || y+i >= d.statusBarY() {
+			continue
+		}
+		pad := strings.Repeat(" ", w-wordwrap.Width(s))
+		d.drawLine(y+i, d.overlayLine(y+i, col, w+2, "\x1b["+popupStyle+" "+s+pad+" \x1b[0m"))
+		d.overlay = append(d.overlay, y+i)
+	}
+}
+
+// overlayLine returns screen line y, other than the cursor's, with box drawn
+// over it from column col to col+w. The text either side of the box is shown
+// as drawText would show it, and wide characters partly under it are hidden.
+func (d *Doc) overlayLine(y, col, w int, box string) string {
+	var l string
+	var spans []span
+	if p := d.viewY + y - 1; p < len(d.lines) {
+		l, spans = d.lines[p], d.spans(p)
+	}
+	left := wordwrap.Offset(l, col)
+	s := styled(l, 0, left, spans) + strings.Repeat(" ", col-wordwrap.Width(l[:left])) + box
+
+	end, suffix := len(l), ""
+	if wordwrap.Width(l) > d.textWidth() {
+		end, suffix = wordwrap.Offset(l, d.textWidth()), ">"
+	}
+	right := wordwrap.Offset(l, col+w)
+	if right < len(l) && wordwrap.Width(l[:right]) < col+w {
+		right = wordwrap.NextBoundary(l, right)
+	}
+	if right < end {
+		s += strings.Repeat(" ", wordwrap.Width(l[:right])-col-w) + styled(l, right, end, spans)
+	}
+	return s + suffix
+}
+
+// drawGhost draws the best prediction which can be shown inline as dim text
+// after the cursor.
+func (d *Doc) drawGhost() {
+	d.clearOverlay()
+	for i, m := range d.predictions {
+		ghost, ok := d.ghostText(m)
+		if !ok {
+			continue
+		}
+		l, x := d.lines[d.y], d.x
+		spans := []span{{x, x + len(ghost), ghostStyle}}
+		for _, s := range d.spans(d.y) {
+			// Spans after the cursor move along with the text.
+			if s.x0 >= x {
+				s.x0 += len(ghost)
+			}
+			if s.x1 > x {
+				s.x1 += len(ghost)
+			}
+			spans = append(spans, s)
+		}
+		y := d.y - d.viewY + 1
+		d.drawLine(y, d.renderLine(d.y, l[:x]+ghost+l[x:], spans))
+		d.overlay = append(d.overlay, y)
+		d.ghost = i
+		return
+	}
+}
+
+// ghostText returns the text which m adds after the cursor. Corrections,
+// which change the text before the cursor other than by its case, cannot be
+// shown.
+func (d *Doc) ghostText(m ngram.Match) (string, bool) {
+	if m.Replace == 0 {
+		return m.Text, m.Text != ""
+	}
+	before := d.lines[d.y][:d.x]
+	if m.Replace > len(before) || m.Replace > len(m.Text) {
+		return "", false
+	}
+	if !strings.EqualFold(m.Text[:m.Replace], before[len(before)-m.Replace:]) {
+		return "", false
+	}
+	return m.Text[m.Replace:], len(m.Text) > m.Replace
+}
+
+// AcceptGhost accepts the prediction shown as ghost text, returning false if
+// there is none.
+func (d *Doc) AcceptGhost() (bool, error) {
+	if !d.predicting() || d.ghost < 0 || d.ghost >= len(d.predictions) {
+		return false, nil
+	}
+	// Each accepted prediction is a separate undo step.
+	d.checkpoint(editOther)
+	d.dirty = true
+	d.addPrediction(d.ghost)
+	d.reflow()
+	d.Redraw()
+	return true, d.showPredictions()
+}
+
+// clearOverlay redraws the text covered by the popup or ghost text.
+func (d *Doc) clearOverlay() {
+	for _, y := range d.overlay {
+		d.drawText(y)
+	}
+	d.overlay, d.ghost = nil, -1
+}
+
+func (d *Doc) textHeight() int {
+	if d.auto && d.opts.Panel == PanelBottom {
+		return d.height - 1 - d.panelHeight()
+	}
+	return d.height - 1
+}
+
+func (d *Doc) statusBarY() int {
+	return d.height
+}
+
+func (d *Doc) predictionsY() int {
+	return d.height - d.panelHeight()
+}
+
+// predictionsHeight returns the number of lines at the bottom of the screen
+// used by the prediction panel.
+func (d *Doc) predictionsHeight() int {
+	if d.auto && d.opts.Panel == PanelBottom {
+		return d.panelHeight()
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package view
+
+import (
+	"mherr/prose/ngram"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPopup(t *testing.T) {
+	ms := ngram.Matches{{Text: "one"}, {Text: "two"}, {Text: "three"}}
+	tests := []struct {
+		desc    string
+		y, x    int
+		overlay []int
+		col     int
+	}{
+		{"below the cursor", 0, 4, []int{2, 3, 4}, 4},
+		{"above the cursor at the bottom", 20, 4, []int{18, 19, 20}, 4},
+		{"within the text at the right", 0, 71, []int{2, 3, 4}, 70},
+	}
+	line := "xxx " + strings.Repeat("x", 66) + " xxxxxxx"
+	for _, c := range tests {
+		d := testDoc(t, strings.Repeat(line+"\n\n", 11), Options{Panel: PanelPopup})
+		d.auto = true
+		d.y, d.x = c.y, c.x
+		d.Redraw()
+		d.predictions = ms
+		d.drawPredictions()
+		if !reflect.DeepEqual(d.overlay, c.overlay) {
+			t.Errorf("%v: got lines %v, want %v", c.desc, d.overlay, c.overlay)
+			continue
+		}
+		first := d.lastDraw[c.overlay[0]]
+		if col := strings.Index(first, "\x1b["+popupStyle); col != c.col {
+			t.Errorf("%v: got column %v, want %v in %q", c.desc, col, c.col, first)
+		}
+		if !strings.Contains(first, "; one") {
+			t.Errorf("%v: got %q", c.desc, first)
+		}
+		// Only the text under the popup, 9 columns wide, is covered.
+		for _, y := range d.overlay {
+			l := d.lines[d.viewY+y-1] + strings.Repeat(" ", 80)
+			left, right := l[:c.col], strings.TrimRight(l[c.col+9:], " ")
+			if got := d.lastDraw[y]; !strings.HasPrefix(got, left) || !strings.HasSuffix(got, " \x1b[0m"+right) {
+				t.Errorf("%v: got %q on line %v", c.desc, got, y)
+			}
+		}
+
+		// The text covered is drawn again when the popup is cleared.
+		d.hidePredictions()
+		if len(d.overlay) != 0 || d.lastDraw[c.overlay[0]] != d.render(d.viewY+c.overlay[0]-1) {
+			t.Errorf("%v: the popup was not cleared: %q", c.desc, d.lastDraw[c.overlay[0]])
+		}
+	}
+}
+
+func TestGhost(t *testing.T) {
+	d := testDoc(t, "hel\n\n```\nhel\n```\n", Options{Panel: PanelInline, Markdown: true})
+	d.auto = true
+	d.x = 3
+	d.Redraw()
+	d.predictions = ngram.Matches{{Text: "Hello", Replace: 3}, {Text: "help"}}
+	d.drawPredictions()
+	if d.ghost != 0 || !reflect.DeepEqual(d.overlay, []int{1}) {
+		t.Fatalf("got ghost %v on lines %v", d.ghost, d.overlay)
+	}
+	if got, want := d.lastDraw[1], "hel\x1b["+ghostStyle+"lo\x1b[0m"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	accepted, err := d.AcceptGhost()
+	if err != nil || !accepted {
+		t.Fatalf("got %v, %v", accepted, err)
+	}
+	checkDoc(t, "accepted", d, []string{"Hello ", "", "```", "hel", "```"}, 0, 6)
+	// The ghost text shown has gone with the predictions it came from.
+	if accepted, _ := d.AcceptGhost(); accepted {
+		t.Error("accepted the ghost text twice")
+	}
+
+	// Predictions are not made, nor accepted, in code.
+	d.y, d.x = 3, 3
+	d.predictions, d.ghost = ngram.Matches{{Text: "help"}}, 0
+	if accepted, _ := d.AcceptGhost(); accepted {
+		t.Error("accepted ghost text in code")
+	}
+}
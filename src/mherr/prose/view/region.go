@@ -0,0 +1,259 @@
+package view
+
+import (
+	"bytes"
+	"math"
+	"mherr/prose/conio"
+	"mherr/prose/wordwrap"
+	"strings"
+)
+
+const (
+	selectionStyle = "7m" // Reverse video
+
+	// maxKills is the number of entries retained in the kill ring.
+	maxKills = 30
+)
+
+// killRing contains recently cut or copied text, newest last.
+type killRing []string
+
+func (k *killRing) push(s string) {
+	*k = append(*k, s)
+	if len(*k) > maxKills {
+		*k = (*k)[1:]
+	}
+}
+
+// get returns the i'th most recent entry.
+func (k killRing) get(i int) string {
+	return k[len(k)-1-i%len(k)]
+}
+
+// yank tracks the most recent paste, so it can be replaced by an older entry
+// in the kill ring.
+type yank struct {
+	before snapshot
+	index  int
+}
+
+// SetMark starts a selection at the cursor, or clears it if the mark is
+// already at the cursor.
+func (d *Doc) SetMark() {
+	here := pos{d.y, d.x}
+	if d.mark != nil && *d.mark == here {
+		d.ClearMark()
+		return
+	}
+	d.mark = &here
+	d.shiftSelect = false
+	d.WriteStatus("Mark set.")
+	d.moveCursor()
+}
+
+// ClearMark removes the selection.
+func (d *Doc) ClearMark() {
+	d.mark = nil
+	d.shiftSelect = false
+	d.Redraw()
+}
+
+// Select moves the cursor, extending the selection.
+func (d *Doc) Select(dy, dx int) {
+	if d.mark == nil {
+		d.mark = &pos{d.y, d.x}
+		d.shiftSelect = true
+	}
+	d.move(dy, dx)
+}
+
+// region returns the ordered bounds of the selection.
+func (d *Doc) region() (start, end pos, ok bool) {
+	if d.mark == nil {
+		return pos{}, pos{}, false
+	}
+	start, end = *d.mark, pos{d.y, d.x}
+	if end.before(start) {
+		start, end = end, start
+	}
+	return start, end, start != end
+}
+
+// regionSpans returns the selected part of line y.
+func (d *Doc) regionSpans(y int) []span {
+	start, end, ok := d.region()
+	if !ok || y < start.y || y > end.y {
+		return nil
+	}
+	sp := span{0, len(d.lines[y]), selectionStyle}
+	if y == start.y {
+		sp.x0 = start.x
+	}
+	if y == end.y {
+		sp.x1 = end.x
+	}
+	return []span{sp}
+}
+
+// text returns the text between two positions. Lines folded within a
+// paragraph are joined with spaces, other lines with newlines.
+func (d *Doc) text(start, end pos) string {
+	if start.y == end.y {
+		return d.lines[start.y][start.x:end.x]
+	}
+	var b bytes.Buffer
+	b.WriteString(d.lines[start.y][start.x:])
+	for y := start.y + 1; y <= end.y; y++ {
+		prev, l := d.lines[y-1], d.lines[y]
+		if prev != "" && l != "" && !preformatted(prev) && !preformatted(l) {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte('\n')
+		}
+		if y == end.y {
+			l = l[:end.x]
+		}
+		b.WriteString(l)
+	}
+	return b.String()
+}
+
+// Copy adds the selection to the kill ring and the terminal's clipboard.
+func (d *Doc) Copy() {
+	start, end, ok := d.region()
+	if !ok {
+		d.WriteStatus("No selection.")
+		d.moveCursor()
+		return
+	}
+	d.kill(d.text(start, end))
+	d.ClearMark()
+	d.WriteStatus("Copied.")
+	d.moveCursor()
+}
+
+// Cut removes the selection, adding it to the kill ring and the terminal's
+// clipboard.
+func (d *Doc) Cut() {
+	start, end, ok := d.region()
+	if !ok {
+		d.WriteStatus("No selection.")
+		d.moveCursor()
+		return
+	}
+	d.kill(d.text(start, end))
+	d.checkpoint(editOther)
+	d.dirty = true
+	d.deleteRegion(start, end)
+	d.Redraw()
+	d.hidePredictions()
+}
+
+func (d *Doc) kill(s string) {
+	d.kills.push(s)
+	conio.Clipboard(s)
+}
+
+// deleteRegion removes the text between two positions and reflows the
+// remainder.
+func (d *Doc) deleteRegion(start, end pos) {
+	joined := d.lines[start.y][:start.x] + d.lines[end.y][end.x:]
+	out := append([]string{}, d.lines[:start.y]...)
+	out = append(out, joined)
+	out = append(out, d.lines[end.y+1:]...)
+	d.lines = out
+	d.y, d.x = start.y, start.x
+	d.reflow()
+	if joined != "" {
+		d.deleteReflow()
+	}
+}
+
+// Paste inserts the most recent entry in the kill ring.
+func (d *Doc) Paste() {
+	if len(d.kills) == 0 {
+		d.WriteStatus("Nothing to paste.")
+		d.moveCursor()
+		return
+	}
+	d.checkpoint(editOther)
+	d.yank = &yank{before: d.history.undo[len(d.history.undo)-1]}
+	d.paste(d.kills.get(0))
+}
+
+// PasteOlder replaces the text just pasted with the next older entry in the
+// kill ring.
+func (d *Doc) PasteOlder() {
+	if d.yank == nil {
+		d.WriteStatus("Previous command was not a paste.")
+		d.moveCursor()
+		return
+	}
+	y := d.yank
+	y.index++
+	d.restore(y.before)
+	d.paste(d.kills.get(y.index))
+}
+
+// PasteText inserts text pasted into the terminal verbatim, without
+// autocompletion, as a single undo step. It is laid out as the text of a file
+// is when loaded, so that it is saved as it was pasted: each line which is not
+// part of a hard-wrapped paragraph is a paragraph of its own.
+func (d *Doc) PasteText(s string) {
+	s = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(s)
+	body := strings.Trim(s, "\n")
+	layout := wordwrap.Parse(body)
+	layout.Lists = d.opts.Markdown
+	// insertText folds the paragraphs to fit the screen.
+	text := strings.Join(layout.Fold(math.MaxInt32), "\n")
+	// As with Enter, a line break before or after the text ends the
+	// paragraph there.
+	if strings.HasPrefix(s, "\n") {
+		text = "\n\n" + text
+	}
+	if strings.HasSuffix(s, "\n") && body != "" {
+		text += "\n\n"
+	}
+	d.checkpoint(editOther)
+	d.paste(text)
+}
+
+func (d *Doc) paste(s string) {
+	d.dirty = true
+	d.mark = nil
+	d.insertText(s)
+	d.Redraw()
+	d.hidePredictions()
+}
+
+// insertText inserts s at the cursor. Each newline in s starts a new line,
+// and the inserted text is folded to fit the screen.
+func (d *Doc) insertText(s string) {
+	here := d.lines[d.y]
+	parts := strings.Split(s, "\n")
+	parts[0] = here[:d.x] + parts[0]
+	last := len(parts) - 1
+	x := len(parts[last])
+	parts[last] += here[d.x:]
+
+	fold := func(l string) []string {
+		if l == "" || preformatted(l) {
+			return []string{l}
+		}
+		return d.wrap(l)
+	}
+	var lines []string
+	for _, p := range parts[:last] {
+		lines = append(lines, fold(p)...)
+	}
+	tail := fold(parts[last])
+	at := d.locate(d.y+len(lines), tail, x)
+	lines = append(lines, tail...)
+
+	out := append([]string{}, d.lines[:d.y]...)
+	out = append(out, lines...)
+	out = append(out, d.lines[d.y+1:]...)
+	d.lines = out
+	d.y, d.x = at.y, at.x
+	d.reflow()
+}
@@ -0,0 +1,95 @@
+package view
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+func TestKillRing(t *testing.T) {
+	var k killRing
+	for i := 0; i < maxKills+5; i++ {
+		k.push(fmt.Sprint(i))
+	}
+	if len(k) != maxKills {
+		t.Errorf("got %v entries, want %v", len(k), maxKills)
+	}
+	if got, want := k.get(0), fmt.Sprint(maxKills+4); got != want {
+		t.Errorf("get(0): got %q, want %q", got, want)
+	}
+	// Older entries wrap around to the newest.
+	if got, want := k.get(maxKills), fmt.Sprint(maxKills+4); got != want {
+		t.Errorf("get(%v): got %q, want %q", maxKills, got, want)
+	}
+}
+
+func TestCutPaste(t *testing.T) {
+	d := testDoc(t, "one two three\n\nfour\n", Options{})
+	d.x = 4
+	d.SetMark()
+	d.Select(0, 4)
+	d.Copy()
+	checkDoc(t, "copy", d, []string{"one two three", "", "four"}, 0, 8)
+	d.mark = &pos{0, 4}
+	d.y, d.x = 2, 0
+	d.Cut()
+	checkDoc(t, "cut", d, []string{"one four"}, 0, 4)
+
+	d.Paste()
+	checkDoc(t, "paste", d, []string{"one two three", "", "four"}, 2, 0)
+	d.Paste()
+	// PasteOlder replaces the text just pasted.
+	d.PasteOlder()
+	checkDoc(t, "paste older", d, []string{"one two three", "", "two four"}, 2, 4)
+	d.PasteOlder()
+	checkDoc(t, "paste older again", d, []string{"one two three", "", "two three", "", "four"}, 4, 0)
+
+	// Only a paste can be replaced.
+	d.Edit('x')
+	d.PasteOlder()
+	checkDoc(t, "not after a paste", d, []string{"one two three", "", "two three", "", "xfour"}, 4, 1)
+
+	d.Undo()
+	d.Undo()
+	checkDoc(t, "undo", d, []string{"one two three", "", "four"}, 2, 0)
+}
+
+func TestPasteText(t *testing.T) {
+	tests := []struct {
+		text  string
+		lines []string
+		y, x  int
+	}{
+		{"a b", []string{"one a btwo"}, 0, 7},
+		{"a\nb", []string{"one a", "", "btwo"}, 2, 1},
+		{"a\r\nb\rc", []string{"one a", "", "b", "", "ctwo"}, 4, 1},
+		{"a\n\nb\n", []string{"one a", "", "b", "", "two"}, 4, 0},
+		{"\n", []string{"one ", "", "two"}, 2, 0},
+		{"  code\n  more\n", []string{"one   code", "  more", "", "two"}, 3, 0},
+		// Hard-wrapped lines are a paragraph.
+		{"The quick brown fox jumps over the lazy dog once\nagain.\n", []string{"one The quick brown fox jumps over the lazy dog once again.", "", "two"}, 2, 0},
+	}
+	for _, c := range tests {
+		d := testDoc(t, "one two\n", Options{})
+		d.x = 4
+		d.PasteText(c.text)
+		checkDoc(t, fmt.Sprintf("PasteText(%q)", c.text), d, c.lines, c.y, c.x)
+		d.Undo()
+		checkDoc(t, fmt.Sprintf("PasteText(%q) undone", c.text), d, []string{"one two"}, 0, 4)
+	}
+}
+
+func TestPasteTextSave(t *testing.T) {
+	d := testDoc(t, "Some text.\n\nThe end.\n", Options{})
+	d.y = 2
+
+	// Each line pasted is saved as a line, not joined in a paragraph.
+	d.PasteText("555-1234\r\nx = 1;\r\ny = 2;\r\n")
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	want := "Some text.\n\n555-1234\n\nx = 1;\n\ny = 2;\n\nThe end.\n"
+	if data, _ := ioutil.ReadFile(d.filename); string(data) != want {
+		t.Errorf("saved %q, want %q", data, want)
+	}
+}
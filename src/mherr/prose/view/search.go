@@ -0,0 +1,517 @@
+package view
+
+import (
+	"fmt"
+	"mherr/prose/wordwrap"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	matchStyle   = "4m" // Underline
+	currentStyle = "7m" // Reverse video
+)
+
+// pos is a position within the document.
+type pos struct {
+	y, x int
+}
+
+func (p pos) before(o pos) bool {
+	return p.y < o.y || p.y == o.y && p.x < o.x
+}
+
+// para is a logical paragraph, which may be folded across several lines.
+type para struct {
+	// The first line of the paragraph.
+	y int
+	// The paragraph text, with its lines joined by spaces.
+	text string
+	// The offset within text where each line begins.
+	starts []int
+	// The hanging indent of each line of a list item, in Markdown mode,
+	// which is not part of text.
+	indents []int
+}
+
+// pos converts an offset within the paragraph into a document position.
+func (p para) pos(off int) pos {
+	i := len(p.starts) - 1
+	for i > 0 && p.starts[i] > off {
+		i--
+	}
+	return pos{p.y + i, off - p.starts[i] + p.indent(i)}
+}
+
+// offset converts a document position within the paragraph into an offset.
+func (p para) offset(at pos) int {
+	i := at.y - p.y
+	x := at.x - p.indent(i)
+	if x < 0 {
+		x = 0
+	}
+	return p.starts[i] + x
+}
+
+// indent returns the width of the hanging indent of line i.
+func (p para) indent(i int) int {
+	if i < len(p.indents) {
+		return p.indents[i]
+	}
+	return 0
+}
+
+// end returns the line after the paragraph.
+func (p para) end() int {
+	return p.y + len(p.starts)
+}
+
+func preformatted(l string) bool {
+	return len(l) > 0 && (l[0] == ' ' || l[0] == '\t')
+}
+
+// paragraphs splits the document into logical paragraphs, in the same way as
+// wordwrap.Unfold. Preformatted lines are each a paragraph of their own. In
+// Markdown mode, each list item is a paragraph, including the lines with its
+// hanging indent.
+func (d *Doc) paragraphs() []para {
+	return d.paragraphsIn(0, len(d.lines))
+}
+
+// paragraphsIn returns the paragraphs of lines start to end, which must not
+// begin or end within a paragraph.
+func (d *Doc) paragraphsIn(start, end int) []para {
+	var (
+		res  []para
+		cur  *para
+		hang string
+		text strings.Builder
+	)
+	// begin starts a paragraph at line y, and flush ends it.
+	flush := func() {
+		if cur != nil {
+			cur.text = text.String()
+			text.Reset()
+		}
+		cur = nil
+	}
+	begin := func(y int, l string, indents []int) {
+		flush()
+		res = append(res, para{y: y, starts: []int{0}, indents: indents})
+		cur = &res[len(res)-1]
+		text.WriteString(l)
+	}
+	// join adds line y to the paragraph, after its hanging indent.
+	join := func(y, indent int) {
+		if !d.brokenWord(d.lines[y-1]) {
+			text.WriteByte(' ')
+		}
+		l := d.lines[y][indent:]
+		cur.starts = append(cur.starts, text.Len())
+		if cur.indents != nil {
+			cur.indents = append(cur.indents, indent)
+		}
+		text.WriteString(l)
+	}
+
+	md := d.opts.Markdown
+	for y := start; y < end; y++ {
+		l := d.lines[y]
+		switch {
+		case l == "":
+			flush()
+		case md && wordwrap.ListMarker(l) > 0:
+			begin(y, l, []int{0})
+			hang = strings.Repeat(" ", wordwrap.ListMarker(l))
+		case md && cur != nil && cur.indents != nil && strings.HasPrefix(l, hang):
+			join(y, len(hang))
+		case preformatted(l):
+			begin(y, l, nil)
+			flush()
+		case cur == nil:
+			begin(y, l, nil)
+		default:
+			join(y, 0)
+		}
+	}
+	flush()
+	return res
+}
+
+// brokenWord returns whether line l ends within a word too long to fit on a
+// line, which wordwrap.Fold broke, so that the next line continues the word.
+func (d *Doc) brokenWord(l string) bool {
+	if wordwrap.Width(l) <= d.textWidth() {
+		return false
+	}
+	if d.opts.Markdown {
+		l = l[wordwrap.ListMarker(l):]
+	}
+	return !strings.ContainsRune(strings.TrimLeft(l, " "), ' ')
+}
+
+// paragraphAt returns the paragraph containing line y. Only the lines
+// between the blank lines around it are read.
+func (d *Doc) paragraphAt(y int) (para, bool) {
+	if d.lines[y] == "" {
+		return para{}, false
+	}
+	start, end := y, y+1
+	for start > 0 && d.lines[start-1] != "" {
+		start--
+	}
+	for end < len(d.lines) && d.lines[end] != "" {
+		end++
+	}
+	for _, p := range d.paragraphsIn(start, end) {
+		if y >= p.y && y < p.end() {
+			return p, true
+		}
+	}
+	return para{}, false
+}
+
+// match is an occurrence of the search query.
+type match struct {
+	start, end pos
+}
+
+// search is the state of an incremental search.
+type search struct {
+	query   string
+	origin  pos
+	matches []match
+	current int
+	failing bool
+	wrapped bool
+	// left is the number of matches before the origin which a replace has
+	// still to visit.
+	left int
+	// prompt, if set, replaces the search prompt in the status line.
+	prompt string
+}
+
+// findAll returns every occurrence of query in the document. If the query is
+// all lower case, the search ignores case.
+func (d *Doc) findAll(query string) []match {
+	if query == "" {
+		return nil
+	}
+	fold := strings.ToLower(query) == query
+	var res []match
+	for _, p := range d.paragraphs() {
+		for i := range p.text {
+			n := -1
+			switch {
+			case strings.HasPrefix(p.text[i:], query):
+				n = len(query)
+			case fold:
+				n = prefixFold(p.text[i:], query)
+			}
+			if n >= 0 {
+				res = append(res, match{p.pos(i), p.pos(i + n)})
+			}
+		}
+	}
+	return res
+}
+
+// prefixFold returns the length of the prefix of s which equals query, when
+// case is ignored, or -1 if there is none. It need not be as long as query:
+// the Kelvin sign is longer than the K it folds to, for example.
+func prefixFold(s, query string) int {
+	i := 0
+	for _, q := range query {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if n == 0 || !equalFold(r, q) {
+			return -1
+		}
+		i += n
+	}
+	return i
+}
+
+// equalFold returns whether r and q are the same letter, ignoring case.
+func equalFold(r, q rune) bool {
+	if r == q {
+		return true
+	}
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f == q {
+			return true
+		}
+	}
+	return false
+}
+
+// StartSearch begins an incremental search from the cursor.
+func (d *Doc) StartSearch() {
+	d.breakGroup()
+	d.search = &search{origin: pos{d.y, d.x}}
+	d.hidePredictions()
+	d.Redraw()
+}
+
+// Search updates the query of the incremental search, and moves to the first
+// match at or after the start of the search.
+func (d *Doc) Search(query string) {
+	s := d.search
+	s.query = query
+	s.matches = d.findAll(query)
+	s.wrapped = false
+	s.failing = query != "" && len(s.matches) == 0
+	s.current = -1
+	for i, m := range s.matches {
+		if !m.start.before(s.origin) {
+			s.current = i
+			break
+		}
+	}
+	if s.current == -1 && len(s.matches) > 0 {
+		s.current = 0
+		s.wrapped = true
+	}
+	d.jumpToMatch()
+}
+
+// SearchNext moves to the next match in the given direction, wrapping around
+// the ends of the document.
+func (d *Doc) SearchNext(dir int) {
+	s := d.search
+	if len(s.matches) == 0 {
+		return
+	}
+	s.current += dir
+	s.wrapped = s.current < 0 || s.current >= len(s.matches)
+	s.current = (s.current + len(s.matches)) % len(s.matches)
+	d.jumpToMatch()
+}
+
+// EndSearch leaves search mode. If keep is false, the cursor is returned to
+// where the search began.
+func (d *Doc) EndSearch(keep bool) {
+	if !keep {
+		d.y, d.x = d.search.origin.y, d.search.origin.x
+	}
+	d.search = nil
+	d.lastDraw = make(map[int]string)
+	d.Redraw()
+}
+
+// jumpToMatch moves the cursor to the current match.
+func (d *Doc) jumpToMatch() {
+	s := d.search
+	if s.current >= 0 && s.current < len(s.matches) {
+		m := s.matches[s.current]
+		d.y, d.x = m.start.y, m.start.x
+	} else {
+		d.y, d.x = s.origin.y, s.origin.x
+	}
+	d.Redraw()
+}
+
+func (d *Doc) drawSearchPrompt() {
+	s := d.search
+	if s.prompt != "" {
+		d.WriteStatus(s.prompt)
+		return
+	}
+	var status string
+	switch {
+	case s.failing:
+		status = "Failing search"
+	case s.wrapped:
+		status = "Wrapped search"
+	default:
+		status = "Search"
+	}
+	info := ""
+	if len(s.matches) > 0 {
+		info = fmt.Sprintf(" [%v/%v]", s.current+1, len(s.matches))
+	}
+	d.WriteStatus(fmt.Sprintf("%v%v: %v", status, info, s.query))
+}
+
+// searchSpans returns the highlighted matches on line y.
+func (d *Doc) searchSpans(y int) []span {
+	s := d.search
+	if s == nil {
+		return nil
+	}
+	var res []span
+	for i, m := range s.matches {
+		if m.start.y > y || m.end.y < y {
+			continue
+		}
+		sp := span{0, len(d.lines[y]), matchStyle}
+		if m.start.y == y {
+			sp.x0 = m.start.x
+		}
+		if m.end.y == y {
+			sp.x1 = m.end.x
+		}
+		if i == s.current {
+			sp.style = currentStyle
+		}
+		res = append(res, sp)
+	}
+	return res
+}
+
+// StartReplace begins a query-replace of from with to, starting at the
+// cursor. It returns false if there are no matches.
+func (d *Doc) StartReplace(from, to string) bool {
+	d.StartSearch()
+	s := d.search
+	s.matches = d.findAll(from)
+	s.query = from
+	if len(s.matches) == 0 {
+		d.EndSearch(true)
+		d.WriteStatus(fmt.Sprintf("No matches for %q.", from))
+		d.moveCursor()
+		return false
+	}
+	s.current = -1
+	for i, m := range s.matches {
+		if !m.start.before(s.origin) {
+			s.current = i
+			break
+		}
+	}
+	s.left = s.current
+	if s.current == -1 {
+		s.current, s.wrapped, s.left = 0, true, len(s.matches)
+	}
+	d.Prompt(fmt.Sprintf("Replace %q with %q? (y/n/!/q)", from, to))
+	d.jumpToMatch()
+	return true
+}
+
+// Prompt shows a message in the status line in place of the search prompt.
+func (d *Doc) Prompt(s string) {
+	d.search.prompt = s
+	d.drawStatusLine()
+	d.moveCursor()
+}
+
+// Replace replaces the current match with to, then moves to the following
+// match. Like searching, replacing wraps around the end of the document, to
+// the matches before the cursor when the replace began. It returns false
+// when there are no more matches.
+func (d *Doc) Replace(to string) bool {
+	d.checkpoint(editOther)
+	return d.replace(to)
+}
+
+// ReplaceAll replaces the current match and all those still to be visited
+// with to, as a single undo step.
+func (d *Doc) ReplaceAll(to string) {
+	d.checkpoint(editOther)
+	for d.replace(to) {
+	}
+}
+
+func (d *Doc) replace(to string) bool {
+	s := d.search
+	m := s.matches[s.current]
+	p, ok := d.paragraphAt(m.start.y)
+	if !ok {
+		return d.SkipReplace()
+	}
+
+	d.dirty = true
+	start, end := p.offset(m.start), p.offset(m.end)
+	text := p.text[:start] + to + p.text[end:]
+	lines := []string{text}
+	if !preformatted(text) || len(p.indents) > 0 {
+		lines = d.wrap(text)
+	}
+	d.setParagraph(p, lines)
+	at := d.locate(p.y, lines, start+len(to))
+	d.y, d.x = at.y, at.x
+
+	// Find the remaining matches after the replacement.
+	s.matches = d.findAll(s.query)
+	next := len(s.matches)
+	for i, m := range s.matches {
+		if !m.start.before(at) {
+			next = i
+			break
+		}
+	}
+	return d.nextReplace(next)
+}
+
+// SkipReplace moves to the next match without replacing the current one. It
+// returns false when there are no more matches.
+func (d *Doc) SkipReplace() bool {
+	return d.nextReplace(d.search.current + 1)
+}
+
+// nextReplace moves to match i, the next to replace, or wraps around to the
+// first if there are no more. It returns false, ending the replace, once
+// every match has been visited.
+func (d *Doc) nextReplace(i int) bool {
+	s := d.search
+	switch {
+	case s.wrapped:
+		s.left--
+	case i >= len(s.matches):
+		i, s.wrapped = 0, true
+	}
+	if i >= len(s.matches) || s.wrapped && s.left <= 0 {
+		d.EndSearch(true)
+		return false
+	}
+	s.current = i
+	d.jumpToMatch()
+	return true
+}
+
+// setParagraph replaces the lines of paragraph p.
+func (d *Doc) setParagraph(p para, lines []string) {
+	out := append([]string{}, d.lines[:p.y]...)
+	out = append(out, lines...)
+	out = append(out, d.lines[p.end():]...)
+	d.lines = out
+}
+
+// locate returns the document position of offset off within a paragraph
+// starting at line y, which was folded into lines by wrap.
+func (d *Doc) locate(y int, lines []string, off int) pos {
+	hang := 0
+	if d.opts.Markdown {
+		hang = wordwrap.ListMarker(lines[0])
+	}
+	for i, l := range lines {
+		indent := 0
+		if i > 0 {
+			indent = hang
+		}
+		if off <= len(l)-indent || i == len(lines)-1 {
+			return pos{y + i, off + indent}
+		}
+		off -= len(l) - indent + 1
+	}
+	return pos{y, 0}
+}
+
+// wrap breaks a paragraph into lines narrower than the text area, in the same
+// way as reflow.
+func (d *Doc) wrap(text string) []string {
+	var res []string
+	var hang string
+	if n := wordwrap.ListMarker(text); n > 0 && d.opts.Markdown {
+		hang = strings.Repeat(" ", n)
+	}
+	for wordwrap.Width(text) >= d.textWidth() {
+		cut := strings.LastIndexByte(text[:wordwrap.Offset(text, d.textWidth()-1)+1], ' ')
+		if cut <= 0 || cut < len(hang) {
+			break
+		}
+		res = append(res, text[:cut])
+		text = hang + text[cut+1:]
+	}
+	return append(res, text)
+}
@@ -0,0 +1,121 @@
+package view
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog. ", 4) + "\n\nThe End.\n"
+	d := testDoc(t, text, Options{})
+	if len(d.lines) < 3 {
+		t.Fatalf("the paragraph is not folded: %q", d.lines)
+	}
+	// Find a pair of words either side of a line break.
+	first := d.lines[0][strings.LastIndexByte(d.lines[0], ' ')+1:]
+	second := d.lines[1][:strings.IndexByte(d.lines[1], ' ')]
+	query := first + " " + second
+
+	d.StartSearch()
+	d.Search(query)
+	s := d.search
+	if len(s.matches) == 0 {
+		t.Fatalf("no matches for %q in %q", query, d.lines)
+	}
+	folded := false
+	for _, m := range s.matches {
+		folded = folded || m.start.y != m.end.y
+	}
+	if !folded {
+		t.Errorf("%q is not found across the break in %q: %v", query, d.lines, s.matches)
+	}
+
+	// Lower case queries ignore case; others do not.
+	d.Search("the")
+	if got := len(s.matches); got != 9 {
+		t.Errorf("got %v matches for %q, want 9", got, "the")
+	}
+	d.Search("The")
+	if got, want := s.matches, []match{{pos{len(d.lines) - 1, 0}, pos{len(d.lines) - 1, 3}}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got matches %v for %q, want %v", got, "The", want)
+	}
+
+	// Searching wraps around the ends of the document.
+	d.Search("dog")
+	d.SearchNext(-1)
+	if !s.wrapped || s.current != 3 || d.y != 2 {
+		t.Errorf("did not wrap: got match %v of %v, cursor at %v,%v", s.current, len(s.matches), d.y, d.x)
+	}
+	d.EndSearch(false)
+	if d.y != 0 || d.x != 0 {
+		t.Errorf("the cursor did not return: got %v,%v", d.y, d.x)
+	}
+}
+
+func TestSearchFold(t *testing.T) {
+	tests := []struct {
+		text, query string
+		want        []match
+	}{
+		// The Kelvin sign is three bytes, and K is one.
+		{"5 K. ok", "k", []match{{pos{0, 2}, pos{0, 5}}, {pos{0, 8}, pos{0, 9}}}},
+		{"5 K.", "5 k.", []match{{pos{0, 0}, pos{0, 6}}}},
+		// The capital sharp s is three bytes, and ß is two.
+		{"STRAẞE", "straße", []match{{pos{0, 0}, pos{0, 8}}}},
+		{"straße", "STRASSE", nil},
+	}
+	for _, c := range tests {
+		d := testDoc(t, c.text, Options{})
+		if got := d.findAll(c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("findAll(%q) in %q: got %v, want %v", c.query, c.text, got, c.want)
+		}
+	}
+}
+
+func TestParagraphsBrokenWord(t *testing.T) {
+	word := strings.Repeat("x", 200)
+	d := testDoc(t, "a "+word+" b\n", Options{})
+	if len(d.lines) < 4 {
+		t.Fatalf("the word is not broken: %q", d.lines)
+	}
+	ps := d.paragraphs()
+	if len(ps) != 1 || ps[0].text != "a "+word+" b" {
+		t.Errorf("got paragraphs %+v", ps)
+	}
+	if got := d.findAll(word); len(got) != 1 {
+		t.Errorf("got matches %v for the long word", got)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	d := testDoc(t, "one cat, two cats\n\nred cat\n", Options{})
+	d.y, d.x = 2, 0
+	if !d.StartReplace("cat", "dog") {
+		t.Fatal("no matches")
+	}
+	if !d.Replace("dog") {
+		t.Fatal("the replace ended after the last match")
+	}
+	// Replacing wraps around to the matches before the cursor.
+	checkDoc(t, "wrapped", d, []string{"one cat, two cats", "", "red dog"}, 0, 4)
+	if !d.SkipReplace() {
+		t.Fatal("the replace ended early")
+	}
+	if d.Replace("dog") {
+		t.Error("the replace did not end after the last match")
+	}
+	checkDoc(t, "replaced", d, []string{"one cat, two dogs", "", "red dog"}, 0, 16)
+
+	d.Undo()
+	checkDoc(t, "undo", d, []string{"one cat, two cats", "", "red dog"}, 0, 13)
+
+	// Replacing every match is a single step, and also wraps around.
+	if !d.StartReplace("cat", "mouse") {
+		t.Fatal("no matches")
+	}
+	d.ReplaceAll("mouse")
+	checkDoc(t, "replace all", d, []string{"one mouse, two mouses", "", "red dog"}, 0, 9)
+	d.Undo()
+	checkDoc(t, "undo all", d, []string{"one cat, two cats", "", "red dog"}, 0, 13)
+}
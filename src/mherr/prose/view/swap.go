@@ -0,0 +1,76 @@
+package view
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// SwapName returns the name of the swap file which unsaved changes to filename
+// are autosaved to.
+func SwapName(filename string) string {
+	dir, base := filepath.Split(filename)
+	return filepath.Join(dir, "."+base+".swp")
+}
+
+// recoverable returns the contents of the swap file of filename, if it is
+// newer than the file.
+func recoverable(filename string) ([]byte, bool) {
+	swap, err := os.Stat(SwapName(filename))
+	if err != nil {
+		return nil, false
+	}
+	if st, err := os.Stat(filename); err == nil && !swap.ModTime().After(st.ModTime()) {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(SwapName(filename))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Autosave writes any unsaved changes to the swap file, so they can be
+// recovered if the editor stops without saving them. Failures are shown in
+// the status line, as well as returned.
+func (d *Doc) Autosave() error {
+	if !d.dirty {
+		return nil
+	}
+	data := d.layout.Unfold(d.lines)
+	if d.swapped != nil && bytes.Equal(data, d.swapped) {
+		return nil
+	}
+	if err := d.writeSwap(data); err != nil {
+		d.WriteStatus(fmt.Sprintf("Could not autosave: %v", err))
+		d.moveCursor()
+		return err
+	}
+	d.swapped = data
+	return nil
+}
+
+// writeSwap writes the swap file in the same way as Save writes the document.
+func (d *Doc) writeSwap(data []byte) error {
+	return writeFile(SwapName(d.filename), data, 0600)
+}
+
+// removeSwap removes the swap file, once its changes are saved or abandoned.
+func (d *Doc) removeSwap() error {
+	d.swapped = nil
+	err := os.Remove(SwapName(d.filename))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Close abandons any unsaved changes, removing the swap file, once what has
+// been saved has been learned from.
+func (d *Doc) Close() error {
+	d.cancelPredictions()
+	d.FinishLearning()
+	return d.removeSwap()
+}
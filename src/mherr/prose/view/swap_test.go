@@ -0,0 +1,103 @@
+package view
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAutosave(t *testing.T) {
+	d := testDoc(t, "one\n", Options{})
+	swap := SwapName(d.filename)
+
+	// An unchanged document is not autosaved.
+	if err := d.Autosave(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(swap); !os.IsNotExist(err) {
+		t.Fatalf("autosaved an unchanged document: %v", err)
+	}
+
+	d.x = 3
+	typeText(t, d, " two")
+	if err := d.Autosave(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(swap); err != nil || string(data) != "one two\n" {
+		t.Fatalf("got swap file %q, %v", data, err)
+	}
+	if data, _ := ioutil.ReadFile(d.filename); string(data) != "one\n" {
+		t.Errorf("autosaving changed the file: %q", data)
+	}
+
+	// Saving removes the swap file.
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(swap); !os.IsNotExist(err) {
+		t.Errorf("the swap file was not removed: %v", err)
+	}
+
+	// So does closing, abandoning the changes.
+	typeText(t, d, " three")
+	if err := d.Autosave(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(swap); !os.IsNotExist(err) {
+		t.Errorf("the swap file was not removed: %v", err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	for _, accept := range []bool{false, true} {
+		d := testDoc(t, "one\n", Options{})
+		d.x = 3
+		typeText(t, d, " two")
+		if err := d.Autosave(); err != nil {
+			t.Fatal(err)
+		}
+		// The swap file must be newer than the file.
+		old := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(d.filename, old, old); err != nil {
+			t.Fatal(err)
+		}
+
+		var asked string
+		opts := Options{Recover: func(swap string) bool {
+			asked = swap
+			return accept
+		}}
+		d2, err := newDoc(d.filename, none{}, opts, 80, 24)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if asked != SwapName(d.filename) {
+			t.Errorf("asked about %q, want %q", asked, SwapName(d.filename))
+		}
+		want := []string{"one"}
+		if accept {
+			want = []string{"one two"}
+		}
+		checkDoc(t, "recovered", d2, want, 0, 0)
+		if d2.Dirty() != accept {
+			t.Errorf("recover %v: got dirty %v", accept, d2.Dirty())
+		}
+	}
+
+	// A swap file older than the file is not offered.
+	d := testDoc(t, "one\n", Options{})
+	if err := ioutil.WriteFile(SwapName(d.filename), []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(SwapName(d.filename), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := recoverable(d.filename); ok {
+		t.Errorf("offered to recover %q", data)
+	}
+}
@@ -0,0 +1,141 @@
+package view
+
+// maxUndo is the number of steps retained in the undo history.
+const maxUndo = 1000
+
+// editKind classifies a change so that runs of similar edits can be grouped
+// into a single undo step.
+type editKind int
+
+const (
+	editNone editKind = iota
+	editType
+	editErase
+	editOther
+)
+
+// snapshot is the state of the document before a change. To save memory,
+// most snapshots only keep the lines which differ from the state they are
+// restored over: the first start lines and last end lines are kept from it.
+type snapshot struct {
+	lines      []string
+	start, end int
+	y, x       int
+}
+
+// trim drops the lines which snapshot s has in common with lines, unless it
+// has been trimmed already.
+func (s *snapshot) trim(lines []string) {
+	if s.start > 0 || s.end > 0 {
+		return
+	}
+	start, end := 0, 0
+	for start < len(s.lines) && start < len(lines) && s.lines[start] == lines[start] {
+		start++
+	}
+	for end < len(s.lines)-start && end < len(lines)-start && s.lines[len(s.lines)-end-1] == lines[len(lines)-end-1] {
+		end++
+	}
+	s.lines = append([]string{}, s.lines[start:len(s.lines)-end]...)
+	s.start, s.end = start, end
+}
+
+// apply returns the lines of snapshot s, restored over lines.
+func (s snapshot) apply(lines []string) []string {
+	out := append([]string{}, lines[:s.start]...)
+	out = append(out, s.lines...)
+	return append(out, lines[len(lines)-s.end:]...)
+}
+
+// history contains the undo and redo stacks of a document.
+type history struct {
+	undo, redo []snapshot
+	// last is the kind of the most recent change, used for grouping.
+	last editKind
+}
+
+func (d *Doc) snapshot() snapshot {
+	return snapshot{
+		lines: append([]string{}, d.lines...),
+		y:     d.y,
+		x:     d.x,
+	}
+}
+
+func (d *Doc) restore(s snapshot) {
+	d.lines = s.apply(d.lines)
+	d.y = s.y
+	d.x = s.x
+	d.dirty = true
+	d.mark = nil
+	d.reindex = true
+}
+
+// checkpoint records the current state before a change of the given kind.
+// Consecutive typed or erased characters are grouped into a single step.
+// Any change also ends the selection and the most recent paste, and any
+// change but typing means the document must be indexed again.
+func (d *Doc) checkpoint(kind editKind) {
+	d.mark = nil
+	d.yank = nil
+	if kind != editType {
+		d.reindex = true
+	}
+	h := &d.history
+	if kind != editOther && kind == h.last {
+		return
+	}
+	h.last = kind
+	// The last snapshot is restored over the state now, so it need only keep
+	// the lines changed since. The new one keeps every line, as they may be
+	// changed by more typing.
+	if len(h.undo) > 0 {
+		h.undo[len(h.undo)-1].trim(d.lines)
+	}
+	h.undo = append(h.undo, d.snapshot())
+	if len(h.undo) > maxUndo {
+		h.undo = h.undo[1:]
+	}
+	h.redo = nil
+}
+
+// breakGroup ends the current run of typing, so that the next typed
+// character starts a new undo step.
+func (d *Doc) breakGroup() {
+	d.history.last = editNone
+	d.yank = nil
+}
+
+// Undo reverts the most recent change.
+func (d *Doc) Undo() {
+	h := &d.history
+	h.last = editNone
+	if len(h.undo) == 0 {
+		d.WriteStatus("Nothing to undo.")
+		d.moveCursor()
+		return
+	}
+	h.redo = append(h.redo, d.snapshot())
+	d.restore(h.undo[len(h.undo)-1])
+	h.undo = h.undo[:len(h.undo)-1]
+	h.redo[len(h.redo)-1].trim(d.lines)
+	d.Redraw()
+	d.hidePredictions()
+}
+
+// Redo reapplies the most recently undone change.
+func (d *Doc) Redo() {
+	h := &d.history
+	h.last = editNone
+	if len(h.redo) == 0 {
+		d.WriteStatus("Nothing to redo.")
+		d.moveCursor()
+		return
+	}
+	h.undo = append(h.undo, d.snapshot())
+	d.restore(h.redo[len(h.redo)-1])
+	h.redo = h.redo[:len(h.redo)-1]
+	h.undo[len(h.undo)-1].trim(d.lines)
+	d.Redraw()
+	d.hidePredictions()
+}
@@ -0,0 +1,62 @@
+package view
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	d := testDoc(t, "one two\n", Options{})
+	d.x = 3
+	typeText(t, d, " and a half")
+	d.Backspace()
+	d.Backspace()
+	d.Enter()
+	typeText(t, d, "three")
+	checkDoc(t, "edited", d, []string{"one and a ha", "", "three two"}, 2, 5)
+
+	// Runs of typing and of erasing are each a single step.
+	steps := []struct {
+		lines []string
+		y, x  int
+	}{
+		{[]string{"one and a ha", "", " two"}, 2, 0},
+		{[]string{"one and a ha two"}, 0, 12},
+		{[]string{"one and a half two"}, 0, 14},
+		{[]string{"one two"}, 0, 3},
+	}
+	for i, s := range steps {
+		d.Undo()
+		checkDoc(t, fmt.Sprint("undo ", i+1), d, s.lines, s.y, s.x)
+	}
+	d.Undo()
+	checkDoc(t, "nothing to undo", d, []string{"one two"}, 0, 3)
+
+	for i := len(steps) - 2; i >= 0; i-- {
+		d.Redo()
+		checkDoc(t, fmt.Sprint("redo ", len(steps)-1-i), d, steps[i].lines, steps[i].y, steps[i].x)
+	}
+	d.Redo()
+	checkDoc(t, "redo all", d, []string{"one and a ha", "", "three two"}, 2, 5)
+
+	// Undoing, and then making a change, forgets what was undone.
+	d.Undo()
+	typeText(t, d, "four")
+	d.Redo()
+	checkDoc(t, "nothing to redo", d, []string{"one and a ha", "", "four two"}, 2, 4)
+	d.Undo()
+	checkDoc(t, "undo after redo", d, []string{"one and a ha", "", " two"}, 2, 0)
+}
+
+func TestUndoLimit(t *testing.T) {
+	d := testDoc(t, "", Options{})
+	for i := 0; i < maxUndo+10; i++ {
+		d.Enter()
+	}
+	for i := 0; i < maxUndo+10; i++ {
+		d.Undo()
+	}
+	// Only the most recent changes can be undone.
+	want := make([]string, 20+1)
+	checkDoc(t, "undo", d, want, 20, 0)
+}
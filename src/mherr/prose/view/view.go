@@ -4,6 +4,7 @@ package view
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"mherr/prose/conio"
@@ -13,11 +14,15 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 // Doc is an in-memory document.
 type Doc struct {
 	filename      string
+	opts          Options
 	auto          bool
 	dirty         bool
 	lastDraw      map[int]string
@@ -26,32 +31,128 @@ type Doc struct {
 	y, x          int
 	width, height int
 	predictions   ngram.Matches
+	history       history
+	search        *search
+	mark          *pos
+	shiftSelect   bool
+	kills         killRing
+	yank          *yank
+	// The ngrams already learned from the document. They are added to the
+	// personal ngram store in the background, and the first failure not yet
+	// shown is sent to learnFailed.
+	learned     map[string]int
+	learning    sync.WaitGroup
+	learnFailed chan error
+	// The ngrams in the document, as it is edited. While text is typed,
+	// only the paragraph typed in is indexed again; any other change
+	// reindexes the whole document.
+	index   *ngram.Index
+	typing  typing
+	reindex bool
+	// Predicts text from the corpus and the document's own ngrams.
+	predictor ngram.Predictor
+	// Predictions made in the background are sent to predicted. Only those
+	// of the current generation are shown, and cancel stops them being made.
+	predicted  chan Predicted
+	predictGen int
+	cancel     context.CancelFunc
+	// The screen lines covered by the prediction popup or ghost text.
+	overlay []int
+	// The prediction shown as ghost text, or -1 if there is none.
+	ghost int
+	// The text last autosaved to the swap file, if any.
+	swapped []byte
+	// The file on disk when it was loaded or saved, and when it was last
+	// checked for changes, and its contents, as the base of merges.
+	disk, polled diskState
+	base         []byte
+	// The line endings of the file, kept when it is saved.
+	format format
+	// The layout of the text when it was loaded, so that unedited
+	// paragraphs are saved as they were written.
+	layout *wordwrap.Layout
+	// Whether each line is fenced code, as of the last redraw.
+	code []bool
+}
+
+// Options configures a document.
+type Options struct {
+	// ShowScores shows the score of each prediction in the prediction panel.
+	ShowScores bool
+	// Budget limits the time spent predicting text. The predictions made
+	// in time are shown. There is no limit if it is zero.
+	Budget time.Duration
+	// Cases gives the usual casing of words which are not usually written
+	// in lower case. It may be nil.
+	Cases ngram.Cases
+	// Phrases predicts the rest of likely phrases as well as the next word.
+	Phrases bool
+	// Panel is where predictions are shown, and PanelHeight is the most
+	// shown at once, or 8 if zero.
+	Panel       Panel
+	PanelHeight int
+	// Keys are the keys which accept each prediction shown, in order, or
+	// ";1234567" if empty. Tab also accepts the first.
+	Keys string
+	// Recover is asked whether to recover the unsaved changes found in a
+	// swap file newer than the document. If it is nil, they are not.
+	Recover func(swap string) bool
+	// Markdown styles headings, emphasis and code, continues list items
+	// with hanging indents, and does not predict code.
+	Markdown bool
+}
+
+// New creates a new document from the given file, which uses p to predict
+// text. The document's own words are added to the predictions of p. Changes
+// autosaved but never saved may be recovered; see Options.Recover.
+func New(filename string, p ngram.Predictor, opts Options) (*Doc, error) {
+	w, h, err := conio.Size()
+	if err != nil {
+		return nil, err
+	}
+	return newDoc(filename, p, opts, w, h)
 }
 
-// New creates a new document from the given file.
-func New(filename string) (*Doc, error) {
-
+// newDoc creates a new document shown on a terminal of the given size.
+func newDoc(filename string, p ngram.Predictor, opts Options, w, h int) (*Doc, error) {
 	data, err := ioutil.ReadFile(filename)
 	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
-
-	w, h, err := conio.Size()
-	if err != nil {
-		return nil, err
+	text, layout := decode(data)
+	recovered := false
+	if swapped, ok := recoverable(filename); ok && opts.Recover != nil && opts.Recover(SwapName(filename)) {
+		text, recovered = swapped, true
 	}
 
 	d := &Doc{
-		filename: filename,
-		width:    w,
-		height:   h,
-		lastDraw: make(map[int]string),
-		auto:     true,
-	}
-	d.lines = wordwrap.Fold(string(data), d.textWidth())
-	if len(d.lines) == 0 {
-		d.lines = []string{""}
-	}
+		filename:    filename,
+		opts:        opts,
+		width:       w,
+		height:      h,
+		lastDraw:    make(map[int]string),
+		auto:        true,
+		learned:     ngram.CountText(data, ngram.MaxLength),
+		index:       ngram.NewIndex(),
+		reindex:     true,
+		predicted:   make(chan Predicted),
+		ghost:       -1,
+		learnFailed: make(chan error, 1),
+		format:      layout,
+	}
+	d.loaded(data)
+	if recovered {
+		d.dirty, d.swapped = true, text
+	}
+	blended := ngram.Blend(
+		ngram.Weighted{Predictor: p, Weight: 1},
+		ngram.Weighted{Predictor: d.index, Weight: ngram.DocumentWeight},
+	)
+	if !opts.Phrases {
+		blended = ngram.Filter(blended, func(m ngram.Match) bool { return !m.Phrase() })
+	}
+	d.predictor = ngram.Cased(blended, opts.Cases)
+	d.setText(text)
 
 	return d, nil
 }
@@ -70,26 +171,99 @@ func (d *Doc) WindowChanged() error {
 }
 
 func (d *Doc) Redraw() {
+	d.findCode()
 	d.trimView()
-	for y := 0; y < d.textHeight(); y++ {
-		var l string
-		p := d.viewY + y
-		if p < len(d.lines) {
-			l = d.lines[p]
-			if p == d.y {
-				l = l[d.viewX:]
-				if d.viewX > 0 {
-					l = "<" + l[1:]
-				}
+	d.overlay, d.ghost = nil, -1
+	for y := 1; y <= d.textHeight(); y++ {
+		d.drawText(y)
+	}
+	d.drawStatusLine()
+	d.moveCursor()
+}
+
+// drawText draws the text on screen line y.
+func (d *Doc) drawText(y int) {
+	var l string
+	if p := d.viewY + y - 1; p < len(d.lines) {
+		l = d.render(p)
+	}
+	d.drawLine(y, l)
+}
+
+// span is a styled portion of a line, between byte offsets x0 and x1.
+type span struct {
+	x0, x1 int
+	style  string
+}
+
+// spans returns the styled portions of line y.
+func (d *Doc) spans(y int) []span {
+	spans := append(d.markdownSpans(y), d.regionSpans(y)...)
+	return append(spans, d.searchSpans(y)...)
+}
+
+// render returns the visible part of line y, including any styling.
+func (d *Doc) render(y int) string {
+	return d.renderLine(y, d.lines[y], d.spans(y))
+}
+
+// renderLine returns the visible part of l, shown as line y with the given
+// spans.
+func (d *Doc) renderLine(y int, l string, spans []span) string {
+	var prefix, suffix string
+	start, end := 0, len(l)
+	if y == d.y && d.viewX > 0 {
+		start = wordwrap.Offset(l, d.viewX)
+		if start < len(l) {
+			// Replace the first character with a marker, padding wide characters.
+			next := wordwrap.NextBoundary(l, start)
+			prefix = "<" + strings.Repeat(" ", wordwrap.Width(l[start:next])-1)
+			start = next
+		}
+	}
+	if w := wordwrap.Width(prefix); w+wordwrap.Width(l[start:]) > d.textWidth() {
+		end = start + wordwrap.Offset(l[start:], d.textWidth()-w)
+		suffix = ">"
+	}
+	return prefix + styled(l, start, end, spans) + suffix
+}
+
+// styled returns l[start:end] with the escape sequences for the given spans.
+func styled(l string, start, end int, spans []span) string {
+	if len(spans) == 0 {
+		return l[start:end]
+	}
+
+	// Split the text at every span boundary, then style each piece.
+	cuts := []int{start, end}
+	for _, s := range spans {
+		for _, x := range []int{s.x0, s.x1} {
+			if x > start && x < end {
+				cuts = append(cuts, x)
 			}
-			if len(l) > d.textWidth() {
-				l = l[:d.textWidth()] + ">"
+		}
+	}
+	sort.Ints(cuts)
+
+	var b bytes.Buffer
+	for i := 0; i+1 < len(cuts); i++ {
+		x0, x1 := cuts[i], cuts[i+1]
+		if x0 == x1 {
+			continue
+		}
+		var style string
+		for _, s := range spans {
+			if s.x0 <= x0 && x1 <= s.x1 {
+				style += "\x1b[" + s.style
 			}
 		}
-		d.drawLine(y+1, l)
+		b.WriteString(style)
+		b.WriteString(l[x0:x1])
+		if style != "" {
+			b.WriteString("\x1b[0m")
+		}
 	}
-	d.drawStatusLine()
-	d.moveCursor()
+	return b.String()
 }
 
 func (d *Doc) drawLine(y int, l string) {
@@ -107,13 +281,19 @@ func (d *Doc) Dirty() bool {
 }
 
 func (d *Doc) drawStatusLine() {
+	if d.search != nil {
+		d.drawSearchPrompt()
+		return
+	}
 	var b bytes.Buffer
-	fmt.Fprintf(&b, "%5v:%3v ", d.y+1, d.x+1)
+	fmt.Fprintf(&b, "%5v:%3v ", d.y+1, d.col()+1)
 	b.WriteString(" | ")
 	b.WriteString("[Ctl-S]ave")
 	b.WriteString(" [Ctl-D]one")
 	b.WriteString(" [Ctl-A]uto")
 	b.WriteString(" [Ctl-O]ff")
+	b.WriteString(" [Ctl-Z]undo")
+	b.WriteString(" [Ctl-F]ind")
 	b.WriteString(" | ")
 	if d.dirty {
 		b.WriteString("*")
@@ -128,15 +308,18 @@ func (d *Doc) WriteStatus(s string) {
 	conio.Escape("40m")   // Grey backgrtound
 	conio.Out(strings.Repeat(" ", d.Width()))
 	conio.Pos(d.statusBarY(), 1)
-	if len(s) > d.textWidth() {
-		s = s[:d.textWidth()]
-	}
+	s = s[:wordwrap.Offset(s, d.textWidth())]
 	conio.Out(s)
 	conio.Escape("0m") // Reverse video off
 }
 
 func (d *Doc) moveCursor() {
-	conio.Pos(d.y-d.viewY+1, d.x-d.viewX+1)
+	conio.Pos(d.y-d.viewY+1, d.col()-d.viewX+1)
+}
+
+// col returns the display column of the cursor.
+func (d *Doc) col() int {
+	return wordwrap.Width(d.lines[d.y][:d.x])
 }
 
 func (d *Doc) Auto(auto bool) {
@@ -155,13 +338,23 @@ func (d *Doc) checkBounds() {
 	}
 }
 
+// Move moves the cursor, clearing any selection made with Select.
 func (d *Doc) Move(dy, dx int) {
+	if d.shiftSelect {
+		d.mark = nil
+		d.shiftSelect = false
+	}
+	d.move(dy, dx)
+}
+
+func (d *Doc) move(dy, dx int) {
 	defer d.hidePredictions()
+	d.breakGroup()
 	bounce := false
 	i := 0
+	col := d.col()
 	for {
 		d.y += dy
-		d.x += dx
 		i++
 		if i > 10 {
 			d.WriteStatus(fmt.Sprintf("d.x=%v d.y=%v bounce=%v dx=%v dy=%v", d.x, d.y, bounce, dx, dy))
@@ -178,12 +371,14 @@ func (d *Doc) Move(dy, dx int) {
 				bounce = true
 			}
 		}
-		if d.x < 0 {
-			d.x = 0
+		if dy != 0 {
+			// Keep the cursor in the same column when moving between lines.
+			d.x = wordwrap.Offset(d.lines[d.y], col)
 		}
 		if l := len(d.lines[d.y]); d.x > l {
 			d.x = l
 		}
+		d.x = d.step(d.x, dx)
 		if bounce {
 			break
 		}
@@ -196,6 +391,18 @@ func (d *Doc) Move(dy, dx int) {
 	d.Redraw()
 }
 
+// step moves the offset x within the current line by n characters.
+func (d *Doc) step(x, n int) int {
+	l := d.lines[d.y]
+	for ; n > 0 && x < len(l); n-- {
+		x = wordwrap.NextBoundary(l, x)
+	}
+	for ; n < 0 && x > 0; n++ {
+		x = wordwrap.PrevBoundary(l, x)
+	}
+	return x
+}
+
 func (d *Doc) trimView() {
 	if d.y >= d.viewY+d.textHeight() {
 		d.viewY = d.y - d.textHeight() + 1
@@ -203,29 +410,30 @@ func (d *Doc) trimView() {
 	if d.y < d.viewY {
 		d.viewY = d.y
 	}
-	if d.x > d.viewX+d.textWidth() {
-		d.viewX = d.x - d.textWidth() + 1
-	}
-	if d.x < d.viewX {
-		d.viewX = d.x
-	}
 	if len(d.lines) == 0 {
 		d.viewX = 0
 		return
 	}
-	if len(d.lines[d.y]) < d.textWidth() {
+	col := d.col()
+	if col > d.viewX+d.textWidth() {
+		d.viewX = col - d.textWidth() + 1
+	}
+	if col < d.viewX {
+		d.viewX = col
+	}
+	if wordwrap.Width(d.lines[d.y]) < d.textWidth() {
 		d.viewX = 0
 	}
 }
 
 func (d *Doc) Delete() {
-	d.dirty = true
 	here := d.lines[d.y]
+	if d.x == len(here) && d.y == len(d.lines)-1 {
+		return
+	}
+	d.checkpoint(editErase)
+	d.dirty = true
 	if d.x == len(here) {
-		if d.y == len(d.lines)-1 {
-			return
-		}
-
 		out := append([]string{}, d.lines[:d.y]...)
 		out = append(out, d.lines[d.y]+d.lines[d.y+1])
 		out = append(out, d.lines[d.y+2:]...)
@@ -233,12 +441,16 @@ func (d *Doc) Delete() {
 		d.Redraw()
 		return
 	}
-	d.lines[d.y] = here[:d.x] + here[d.x+1:]
+	d.lines[d.y] = here[:d.x] + here[wordwrap.NextBoundary(here, d.x):]
 	d.deleteReflow()
 	d.Redraw()
 }
 
 func (d *Doc) Enter() {
+	if d.enterItem() {
+		return
+	}
+	d.checkpoint(editOther)
 	d.dirty = true
 
 	count := 2
@@ -281,6 +493,7 @@ func (d *Doc) char() byte {
 }
 
 func (d *Doc) CtlBackspace() {
+	d.checkpoint(editOther)
 	for {
 		d.backspace()
 		if d.x == 0 || d.char() == ' ' {
@@ -292,6 +505,7 @@ func (d *Doc) CtlBackspace() {
 }
 
 func (d *Doc) Backspace() {
+	d.checkpoint(editErase)
 	d.backspace()
 	d.deleteReflow()
 	d.Redraw()
@@ -312,12 +526,25 @@ func (d *Doc) backspace() {
 		d.y--
 		d.x = len(d.lines[d.y]) - len(moved)
 	} else {
-		d.lines[d.y] = d.lines[d.y][:d.x-1] + d.lines[d.y][d.x:]
-		d.x--
+		prev := wordwrap.PrevBoundary(d.lines[d.y], d.x)
+		d.lines[d.y] = d.lines[d.y][:prev] + d.lines[d.y][d.x:]
+		d.x = prev
 	}
 }
 
-func (d *Doc) Edit(b byte) error {
+func (d *Doc) Edit(r rune) error {
+	accept, isKey := d.acceptKey(r)
+	if isKey && (accept < 0 || accept >= len(d.predictions)) {
+		// There is nothing to accept, so the key is typed.
+		isKey = false
+	}
+	if isKey {
+		// Each accepted prediction is a separate undo step.
+		d.checkpoint(editOther)
+	} else {
+		d.checkpoint(editType)
+	}
+
 	d.dirty = true
 	var here, before, after string
 	here = d.lines[d.y]
@@ -327,19 +554,15 @@ func (d *Doc) Edit(b byte) error {
 	}
 
 	switch {
-	case d.auto && b == '\t':
-		fallthrough
-	case d.auto && b == ';':
-		d.addPrediction(0)
-	case d.auto && b >= '1' && b <= '7':
-		d.addPrediction(int(b) - '0')
+	case isKey:
+		d.addPrediction(accept)
 
 		// Delete spaces before punctuation.
-	case d.auto && b == ',':
+	case d.predicting() && r == ',':
 		fallthrough
-	case d.auto && b == '?':
+	case d.predicting() && r == '?':
 		fallthrough
-	case d.auto && b == '.':
+	case d.predicting() && r == '.':
 		b := strings.TrimRight(before, " ")
 		diff := len(before) - len(b)
 		before = b
@@ -347,8 +570,8 @@ func (d *Doc) Edit(b byte) error {
 		fallthrough
 
 	default:
-		d.lines[d.y] = before + string(b) + after
-		d.x++
+		d.lines[d.y] = before + string(r) + after
+		d.x += utf8.RuneLen(r)
 	}
 
 	d.reflow()
@@ -356,24 +579,130 @@ func (d *Doc) Edit(b byte) error {
 	return d.showPredictions()
 }
 
+// Save saves the document, unless the file has been changed by another
+// program since it was loaded or saved, when it returns ErrChanged.
 func (d *Doc) Save() error {
+	if _, changed, err := d.onDisk(); err != nil || changed {
+		if changed {
+			err = ErrChanged
+		}
+		return err
+	}
+	return d.save()
+}
+
+func (d *Doc) save() error {
 	d.dirty = false
-	if err := ioutil.WriteFile(d.filename+".tmp", wordwrap.Unfold(d.lines), 0666); err != nil {
+	data := d.format.encode(d.layout.Unfold(d.lines))
+	if err := writeFile(d.filename, data, 0666); err != nil {
 		return err
 	}
-	if err := os.Rename(d.filename+".tmp", d.filename); err != nil {
+	d.loaded(data)
+	if err := d.removeSwap(); err != nil {
 		return err
 	}
 
 	d.Redraw()
+	d.learn()
 	return nil
 }
 
+// learn adds the ngrams written since the document was loaded or last saved
+// to the personal ngram store. Each occurrence is only learned once, however
+// often the document is saved. As the store is rewritten, that is done in the
+// background.
+func (d *Doc) learn() {
+	counts := ngram.CountText(wordwrap.Unfold(d.lines), ngram.MaxLength)
+	add := make(map[string]int)
+	for s, n := range counts {
+		if n > d.learned[s] {
+			add[s] = n - d.learned[s]
+			d.learned[s] = n
+		}
+	}
+	if len(add) == 0 {
+		return
+	}
+	d.learning.Add(1)
+	go func() {
+		defer d.learning.Done()
+		if err := ngram.Learn(add); err != nil {
+			select {
+			case d.learnFailed <- err:
+			default:
+			}
+		}
+	}()
+}
+
+// LearnFailed returns a channel which receives failures to learn from the
+// document as it is saved. Each should be passed to ShowLearnFailed.
+func (d *Doc) LearnFailed() <-chan error {
+	return d.learnFailed
+}
+
+// ShowLearnFailed shows a failure received from LearnFailed.
+func (d *Doc) ShowLearnFailed(err error) {
+	d.WriteStatus(fmt.Sprintf("Could not learn from document: %v", err))
+	d.moveCursor()
+}
+
+// FinishLearning waits until what has been saved has been learned from. It
+// should be called before the editor exits.
+func (d *Doc) FinishLearning() {
+	d.learning.Wait()
+}
+
 func (d *Doc) addPrediction(i int) {
 	if i >= len(d.predictions) {
 		return
 	}
-	word := d.predictions[i].Text + " "
+	d.insertPrediction(d.predictions[i])
+}
+
+// AcceptPhrase accepts the best phrase predicted, if any: all of it, or only
+// its next word.
+func (d *Doc) AcceptPhrase(all bool) error {
+	if !d.auto {
+		return nil
+	}
+	for _, m := range d.predictions {
+		end := nextWord(m)
+		if end == len(m.Text) {
+			continue
+		}
+		if !all {
+			m.Text = m.Text[:end]
+		}
+		d.checkpoint(editOther)
+		d.dirty = true
+		d.insertPrediction(m)
+		d.reflow()
+		d.Redraw()
+		return d.showPredictions()
+	}
+	return nil
+}
+
+// nextWord returns the length of the part of m.Text which completes the word
+// at the cursor, or the next word if there is none.
+func nextWord(m ngram.Match) int {
+	i := m.Replace
+	if i > len(m.Text) {
+		i = len(m.Text)
+	}
+	for i < len(m.Text) && m.Text[i] == ' ' {
+		i++
+	}
+	if j := strings.IndexByte(m.Text[i:], ' '); j >= 0 {
+		return i + j
+	}
+	return len(m.Text)
+}
+
+// insertPrediction inserts m at the cursor, followed by a space.
+func (d *Doc) insertPrediction(m ngram.Match) {
+	word := m.Text + " "
 
 	var here, before, after string
 	here = d.lines[d.y]
@@ -381,6 +710,11 @@ func (d *Doc) addPrediction(i int) {
 		before = here[:d.x]
 		after = here[d.x:]
 	}
+	// Replace a misspelt word.
+	if m.Replace > 0 && m.Replace <= len(before) {
+		before = before[:len(before)-m.Replace]
+		d.x -= m.Replace
+	}
 	d.lines[d.y] = before + word + after
 	d.x += len(word)
 }
@@ -391,13 +725,21 @@ func (d *Doc) debug(pat string, args ...interface{}) {
 	d.moveCursor()
 }
 
-func predictions(line string) (ngram.Matches, error) {
-	res, err := ngram.Predictions(line)
-	if err != nil {
-		return nil, err
+func predictions(ctx context.Context, p ngram.Predictor, line string) (ngram.Matches, error) {
+	var (
+		res, space ngram.Matches
+		err, err2  error
+		done       = make(chan bool)
+	)
+	go func() {
+		space, err2 = p.Predict(ctx, line+" ")
+		done <- true
+	}()
+	res, err = p.Predict(ctx, line)
+	<-done
+	if err == nil {
+		err = err2
 	}
-
-	space, err := ngram.Predictions(line + " ")
 	if err != nil {
 		return nil, err
 	}
@@ -409,86 +751,186 @@ func predictions(line string) (ngram.Matches, error) {
 	return res, nil
 }
 
+// Predicted is the result of predicting the text at the cursor.
+type Predicted struct {
+	gen int
+	ms  ngram.Matches
+	err error
+}
+
+// Predicted returns a channel which receives predictions as they are made.
+// Each should be passed to ShowPredicted.
+func (d *Doc) Predicted() <-chan Predicted {
+	return d.predicted
+}
+
+// showPredictions starts predicting the text at the cursor, in the
+// background. Any earlier predictions still being made are cancelled.
 func (d *Doc) showPredictions() error {
-	if !d.auto {
+	d.cancelPredictions()
+	if !d.predicting() {
 		d.hidePredictions()
 		return nil
 	}
-	line := d.lines[d.y][:d.x]
+	// The paragraph so far shows where sentences begin.
+	p, ok := d.paragraphAt(d.y)
+	if !ok {
+		p = para{y: d.y, starts: []int{0}}
+	}
+	line := p.text[:p.offset(pos{d.y, d.x})]
+	d.updateIndex(p, line)
+	d.predictions = nil
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	if d.opts.Budget > 0 {
+		// Show whatever predictions are made in time.
+		ctx, cancel = context.WithTimeout(ctx, d.opts.Budget)
+	}
+	gen := d.predictGen
+	go func() {
+		defer cancel()
+		ms, err := predictions(ctx, d.predictor, line)
+		if ctx.Err() == context.Canceled {
+			return
+		}
+		d.predicted <- Predicted{gen, ms, err}
+	}()
+	return nil
+}
 
-	var err error
-	d.predictions, err = predictions(line)
-	if err != nil {
-		return err
+// cancelPredictions stops any predictions being made, and ensures they are
+// not shown. Any ghost text shown can no longer be accepted.
+func (d *Doc) cancelPredictions() {
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
 	}
-	ws := strings.Split(line, " ")
-	lastWord := ws[len(ws)-1]
+	d.predictGen++
+	d.ghost = -1
+}
 
-	for i := 0; i < d.predictionsHeight(); i++ {
-		var s string
-		if i < len(d.predictions) {
-			m := d.predictions[i]
-			s = fmt.Sprintf("%v %v%v", string(shortcuts[i]), lastWord, m.Text)
-		}
-		d.drawLine(d.predictionsY()+i, s)
+// ShowPredicted shows predictions received from Predicted in the prediction
+// panel, unless they are out of date.
+func (d *Doc) ShowPredicted(p Predicted) error {
+	if p.gen != d.predictGen {
+		return nil
 	}
-	d.moveCursor()
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+	if p.err != nil {
+		return p.err
+	}
+	d.predictions = p.ms
+	d.drawPredictions()
 	return nil
 }
 
+// typing is the paragraph being typed in, as it was last indexed.
+type typing struct {
+	// The first line of the paragraph, and the number of lines after it.
+	y, after int
+	// The text indexed.
+	text string
+}
+
+// updateIndex brings the index of the document's ngrams up to date, given the
+// paragraph at the cursor and its text before the cursor. The word being
+// typed, and the text after it, are left out, so that unfinished words are
+// not predicted.
+func (d *Doc) updateIndex(p para, before string) {
+	t := typing{
+		y:     p.y,
+		after: len(d.lines) - p.end(),
+		text:  before[:strings.LastIndexByte(before, ' ')+1],
+	}
+	// If only the text typed has changed since the paragraph was indexed,
+	// and the paragraph still begins and ends in the same place, the rest
+	// of the document is unchanged.
+	if !d.reindex && t.y == d.typing.y && t.after == d.typing.after {
+		d.index.Replace(d.typing.text, t.text)
+		d.typing = t
+		return
+	}
+	var pars []string
+	for _, q := range d.paragraphs() {
+		if q.y == p.y {
+			q.text = t.text
+		}
+		pars = append(pars, q.text)
+	}
+	d.index.Update(pars)
+	d.typing, d.reindex = t, false
+}
+
 func (d *Doc) hidePredictions() {
+	d.cancelPredictions()
+	d.clearOverlay()
 	for i := 0; i < d.predictionsHeight(); i++ {
 		d.drawLine(d.predictionsY()+i, "")
 	}
 	d.moveCursor()
 }
 
-const shortcuts = ";123456789"
-
 // deleteReflow combines the following line with the current line, then reflows.
 func (d *Doc) deleteReflow() {
 	if d.y >= len(d.lines)-1 {
 		return
 	}
 
-	if d.lines[d.y+1] == "" {
+	next := d.lines[d.y+1]
+	if next == "" || d.opts.Markdown && wordwrap.ListMarker(next) > 0 {
 		return
 	}
+	// The hanging indent of a list item is added back by reflow.
+	if hang := d.hang(d.y); hang != "" {
+		if !strings.HasPrefix(next, hang) {
+			return
+		}
+		next = next[len(hang):]
+	}
 
 	out := append([]string{}, d.lines[:d.y]...)
-	out = append(out, d.lines[d.y]+" "+d.lines[d.y+1])
+	out = append(out, d.lines[d.y]+" "+next)
 	out = append(out, d.lines[d.y+2:]...)
 	d.lines = out
 
 	d.reflow()
 }
 
+// reflow rewraps the paragraph from the cursor's line, carrying words which
+// do not fit onto the next line. Lines after the first of a list item keep
+// its hanging indent.
 func (d *Doc) reflow() {
 	var carry string
 	y := d.y
+	hang := d.hang(d.y)
 	for {
 		if y >= len(d.lines) {
 			if carry != "" {
-				d.lines = append(d.lines, carry)
+				d.lines = append(d.lines, hang+carry)
 			}
 			break
 		}
 
 		if carry != "" {
-			if d.lines[y] == "" {
+			if d.lines[y] == "" || d.startsParagraph(y, hang) {
 				tmp := append([]string{}, d.lines[:y]...)
 				tmp = append(tmp, "")
 				tmp = append(tmp, d.lines[y:]...)
 				d.lines = tmp
 			}
-			d.lines[y] = strings.TrimSuffix(carry+" "+d.lines[y], " ")
+			d.lines[y] = strings.TrimSuffix(hang+carry+" "+strings.TrimPrefix(d.lines[y], hang), " ")
 		}
 
-		if len(d.lines[y]) < d.textWidth() {
+		if wordwrap.Width(d.lines[y]) < d.textWidth() {
 			break
 		}
 
-		for x := d.textWidth() - 1; x >= 0; x-- {
+		// The bullet and hanging indent are not broken.
+		for x := wordwrap.Offset(d.lines[y], d.textWidth()-1); x >= len(hang); x-- {
 			if d.lines[y][x] == ' ' {
 				carry = d.lines[y][x+1:]
 				d.lines[y] = d.lines[y][:x]
@@ -505,11 +947,11 @@ func (d *Doc) reflow() {
 	diff := d.x - len(d.lines[d.y])
 	if diff > 0 {
 		d.y++
-		d.x = diff - 1
+		d.x = len(hang) + diff - 1
 	}
 
 	if d.y >= len(d.lines) {
-		d.lines = append(d.lines, "")
+		d.lines = append(d.lines, hang)
 	}
 	if l := len(d.lines[d.y]); d.x > l {
 		d.x = l
@@ -520,28 +962,6 @@ func (d *Doc) Height() int {
 	return d.height
 }
 
-func (d *Doc) textHeight() int {
-	if d.auto {
-		return d.height - 9
-	}
-	return d.height - 1
-}
-
-func (d *Doc) statusBarY() int {
-	return d.height
-}
-
-func (d *Doc) predictionsY() int {
-	return d.height - 8
-}
-
-func (d *Doc) predictionsHeight() int {
-	if d.auto {
-		return 8
-	}
-	return 0
-}
-
 func (d *Doc) Width() int {
 	return d.width
 }
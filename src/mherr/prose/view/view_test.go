@@ -0,0 +1,106 @@
+package view
+
+import (
+	"context"
+	"io/ioutil"
+	"mherr/prose/conio"
+	"mherr/prose/ngram"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// What the documents draw is not wanted in the test output, nor what
+	// they learn in the personal ngram store.
+	conio.Output = ioutil.Discard
+	dir, err := ioutil.TempDir("", "view")
+	if err != nil {
+		panic(err)
+	}
+	ngram.ResourcePath = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// none predicts nothing.
+type none struct{}
+
+func (none) Predict(ctx context.Context, text string) (ngram.Matches, error) {
+	return nil, nil
+}
+
+// testDoc returns a document loaded from a file with the given contents, on
+// an 80 by 24 terminal, with predictions turned off. If they are turned on,
+// those made in the background are not waited for.
+func testDoc(t *testing.T, text string, opts Options) *Doc {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "doc.txt")
+	if err := ioutil.WriteFile(filename, []byte(text), 0666); err != nil {
+		t.Fatal(err)
+	}
+	d, err := newDoc(filename, none{}, opts, 80, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.auto = false
+	d.predicted = make(chan Predicted, 100)
+	t.Cleanup(d.FinishLearning)
+	return d
+}
+
+// typeText types s at the cursor.
+func typeText(t *testing.T, d *Doc, s string) {
+	t.Helper()
+	for _, r := range s {
+		if err := d.Edit(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkDoc checks the lines of the document, and the position of the cursor.
+func checkDoc(t *testing.T, desc string, d *Doc, lines []string, y, x int) {
+	t.Helper()
+	if !reflect.DeepEqual(d.lines, lines) {
+		t.Errorf("%v: got lines %q, want %q", desc, d.lines, lines)
+	}
+	if d.y != y || d.x != x {
+		t.Errorf("%v: got cursor at %v,%v, want %v,%v", desc, d.y, d.x, y, x)
+	}
+}
+
+func TestEditAcceptKey(t *testing.T) {
+	d := testDoc(t, "one\n", Options{})
+	d.auto = true
+	d.x = 3
+
+	// With nothing to accept, keys which accept predictions are typed.
+	typeText(t, d, " 1;")
+	checkDoc(t, "typed", d, []string{"one 1;"}, 0, 6)
+}
+
+func TestLearn(t *testing.T) {
+	d := testDoc(t, "Thus spoke\n", Options{})
+	d.x = 10
+	typeText(t, d, " Zarathustra")
+
+	// Only what is written in the document is learned, once, however
+	// often it is saved.
+	for i := 0; i < 2; i++ {
+		if err := d.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.FinishLearning()
+	filename := filepath.Join(ngram.ResourcePath, "personal.1.txt")
+	ms, err := ngram.Find(filename, "zarathustra", 1)
+	if err != nil || len(ms) != 1 || ms[0].Freq != 1 {
+		t.Errorf("got %v, %v; want zarathustra learned once", ms, err)
+	}
+	if ms, err := ngram.Find(filename, "thus", 1); err != nil || ms != nil {
+		t.Errorf("got %v, %v; want the text loaded not learned", ms, err)
+	}
+}
@@ -0,0 +1,564 @@
+package wordwrap
+
+import (
+	"bytes"
+	"mherr/prose/diff"
+	"strings"
+)
+
+// Kind is the kind of a block of text in a Layout.
+type Kind int
+
+const (
+	// Plain is a paragraph, which may be hard-wrapped.
+	Plain Kind = iota
+	// Item is an item of a bullet or numbered list, which may be
+	// hard-wrapped with a hanging indent.
+	Item
+	// Quote is a block quote, each line starting with ">".
+	Quote
+	// Code is fenced code, from its opening fence to its closing one.
+	Code
+	// Pre is a run of preformatted lines, each starting with a space or tab.
+	Pre
+)
+
+// minWrap is the narrowest width a file is taken to be hard-wrapped at.
+// Narrower text, such as verse, keeps its line breaks.
+const minWrap = 40
+
+// block is a block of text as it was written in a file.
+type block struct {
+	kind Kind
+	// The text shown: a paragraph unwrapped into one line, or the lines
+	// of preformatted text and code.
+	lines []string
+	// The text as written, and the blank lines after it.
+	raw, sep string
+	// The width the block was hard-wrapped at, or 0 if it was not, and the
+	// indent of the lines after the first.
+	width  int
+	indent string
+}
+
+// Layout is the layout of a file's text: its paragraphs, lists, quotes and
+// code, and how each was written. Unlike Fold and Unfold, folding text with
+// a Layout and unfolding it again gives back the text byte for byte, and only
+// the blocks which were edited are rewritten, in the style of the blocks they
+// replace.
+type Layout struct {
+	// Lists folds list items as Markdown is usually written: lines after
+	// the first have a hanging indent, and there is no blank line between
+	// items which were not written with one.
+	Lists bool
+
+	// Blank lines before the first block.
+	head   string
+	blocks []block
+	// Whether the text ends with a newline.
+	final bool
+	// The lines last returned by Fold, and the range of each block in them.
+	folded []string
+	spans  [][2]int
+}
+
+// Parse returns the layout of text. Consecutive lines are a hard-wrapped
+// paragraph when each was broken because the next word did not fit in the
+// width of the widest line.
+func Parse(text string) *Layout {
+	l := &Layout{final: text == "" || strings.HasSuffix(text, "\n")}
+	raw := strings.SplitAfter(text, "\n")
+	if raw[len(raw)-1] == "" {
+		raw = raw[:len(raw)-1]
+	}
+	lines := make([]string, len(raw))
+	for i, r := range raw {
+		lines[i] = strings.TrimSuffix(r, "\n")
+	}
+	width := wrapWidth(lines)
+
+	i := 0
+	for ; i < len(lines) && blank(lines[i]); i++ {
+		l.head += raw[i]
+	}
+	for i < len(lines) {
+		start := i
+		line := lines[i]
+		b := block{lines: []string{line}}
+		i++
+		switch {
+		case fence(line) != "":
+			b.kind = Code
+			for i < len(lines) {
+				b.lines = append(b.lines, lines[i])
+				i++
+				if closes(lines[i-1], fence(line)) {
+					break
+				}
+			}
+		case ListMarker(line) > 0:
+			b.kind = Item
+			b.indent = strings.Repeat(" ", ListMarker(line))
+			for prev := line; i < len(lines); i++ {
+				next := lines[i]
+				if blank(next) || fence(next) != "" || ListMarker(next) > 0 || quote(next) {
+					break
+				}
+				if !preformatted(next) && !wrapped(prev, next, width) {
+					break
+				}
+				if i == start+1 && preformatted(next) {
+					b.indent = next[:len(next)-len(strings.TrimLeft(next, spaces))]
+				}
+				b.lines[0] += " " + strings.TrimLeft(next, spaces)
+				prev = next
+			}
+		case quote(line):
+			b.kind = Quote
+			b.indent = "> "
+			for prev := line; i < len(lines); i++ {
+				next := lines[i]
+				if !quote(next) || blank(unquote(next)) || !wrapped(prev, unquote(next), width) {
+					break
+				}
+				if i == start+1 {
+					b.indent = next[:len(next)-len(unquote(next))]
+				}
+				b.lines[0] += " " + unquote(next)
+				prev = next
+			}
+		case preformatted(line):
+			b.kind = Pre
+			for ; i < len(lines); i++ {
+				next := lines[i]
+				if blank(next) || !preformatted(next) || ListMarker(next) > 0 || fence(next) != "" {
+					break
+				}
+				b.lines = append(b.lines, next)
+			}
+		default:
+			b.kind = Plain
+			for prev := line; i < len(lines); i++ {
+				next := lines[i]
+				if blank(next) || startsBlock(next) || !wrapped(prev, next, width) {
+					break
+				}
+				b.lines[0] += " " + strings.TrimLeft(next, spaces)
+				prev = next
+			}
+		}
+		if i > start+1 && b.kind != Code && b.kind != Pre {
+			b.width = width
+		}
+		b.raw = strings.Join(raw[start:i], "")
+		for ; i < len(lines) && blank(lines[i]); i++ {
+			b.sep += raw[i]
+		}
+		l.blocks = append(l.blocks, b)
+	}
+	return l
+}
+
+// Fold breaks the text into lines no wider than lim columns, as Fold does:
+// paragraphs, list items and quotes are wrapped, preformatted lines and code
+// are not, and each block is followed by a blank line.
+func (l *Layout) Fold(lim int) []string {
+	var res []string
+	l.spans = l.spans[:0]
+	for i, b := range l.blocks {
+		if i > 0 && !(l.Lists && b.kind == Item && l.blocks[i-1].kind == Item && l.blocks[i-1].sep == "") {
+			res = append(res, "")
+		}
+		start := len(res)
+		switch {
+		case b.kind == Code || b.kind == Pre:
+			res = append(res, b.lines...)
+		case l.Lists && b.kind == Item:
+			s := b.lines[0]
+			n := ListMarker(s)
+			hang := strings.Repeat(" ", n)
+			for j, f := range fold(s[n:], lim-n) {
+				if j == 0 {
+					res = append(res, s[:n]+f)
+				} else {
+					res = append(res, hang+f)
+				}
+			}
+		default:
+			// Fold would take an indented list item to be preformatted.
+			s := b.lines[0]
+			indent := s[:len(s)-len(strings.TrimLeft(s, spaces))]
+			folded := fold(s[len(indent):], lim-Width(indent))
+			folded[0] = indent + folded[0]
+			res = append(res, folded...)
+		}
+		l.spans = append(l.spans, [2]int{start, len(res)})
+	}
+	l.folded = res
+	// The caller may edit the lines, but l.folded must keep them as they were.
+	return append([]string(nil), res...)
+}
+
+// fold folds a line of text into at least one line, however narrow.
+func fold(s string, lim int) []string {
+	if lim < 1 {
+		lim = 1
+	}
+	if res := Fold(s, lim); len(res) > 0 {
+		return res
+	}
+	return []string{""}
+}
+
+// Unfold returns the text of lines, folded by l.Fold and then edited. Blocks
+// whose lines are unchanged are written exactly as they were parsed. Edited
+// and new lines are written as Unfold would, except that they follow the
+// style of the blocks they replace: hard-wrapped at the same width, with the
+// same indent and the same blank lines after them.
+func (l *Layout) Unfold(lines []string) []byte {
+	at := make([]int, len(l.folded))
+	for i := range at {
+		at[i] = -1
+	}
+	for _, p := range diff.Common(l.folded, lines) {
+		at[p.A] = p.B
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(l.head)
+	g := gap{}
+	next := 0
+	for i := range l.blocks {
+		b, span := &l.blocks[i], l.spans[i]
+		start := at[span[0]]
+		kept := start >= next
+		for j := span[0]; kept && j < span[1]; j++ {
+			kept = at[j] == start+j-span[0]
+		}
+		if !kept {
+			if g.first == nil {
+				g.first = b
+			}
+			g.last = b
+			continue
+		}
+		g.lines = lines[next:start]
+		l.rewrite(&buf, g, true)
+		buf.WriteString(b.raw)
+		next = start + span[1] - span[0]
+		g = gap{prev: b, sep: l.sepAfter(b)}
+		// The blank line Fold put after the block.
+		if span[1] < len(l.folded) && l.folded[span[1]] == "" && next < len(lines) && lines[next] == "" {
+			next++
+			g.blank = true
+		}
+	}
+	g.lines = lines[next:]
+	l.rewrite(&buf, g, false)
+
+	if !l.final {
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	}
+	return buf.Bytes()
+}
+
+// gap is a run of edited lines between the blocks kept by Unfold.
+type gap struct {
+	lines []string
+	// The block kept before the lines, the blank lines after it, and
+	// whether a blank line separates them.
+	prev  *block
+	sep   string
+	blank bool
+	// The first and last blocks the lines replace.
+	first, last *block
+}
+
+// rewrite writes the lines of g to buf in the style of the first block they
+// replace, or else the block before them. The blank lines after the block
+// before them are kept at the first blank line, and those after the last
+// block replaced are written at the end.
+func (l *Layout) rewrite(buf *bytes.Buffer, g gap, more bool) {
+	pars, blankBefore := split(g.lines, g.first != nil && (g.first.kind == Code || g.first.kind == Pre))
+	if len(pars) == 0 {
+		if more {
+			buf.WriteString(g.sep)
+		} else {
+			g.end(buf)
+		}
+		return
+	}
+	blankBefore[0] = g.blank || g.lines[0] == ""
+	style := g.first
+	if style == nil {
+		style = g.prev
+	}
+	sep := l.sepAfter(style)
+	if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+		// The last block did not end with a newline, but now text follows it.
+		buf.WriteString("\n")
+	}
+
+	held := g.prev != nil
+	for i, p := range pars {
+		if blankBefore[i] && held {
+			buf.WriteString(g.sep)
+			held = false
+		} else if blankBefore[i] {
+			buf.WriteString(sep)
+		}
+		if style == nil || style.width == 0 || preformatted(p) || fence(p) != "" {
+			buf.WriteString(p)
+			buf.WriteString("\n")
+			continue
+		}
+		buf.WriteString(hardWrap(p, style.width, indentOf(p, style)))
+	}
+
+	switch {
+	case !more:
+		g.end(buf)
+	case held:
+		buf.WriteString(g.sep)
+	case g.last != nil:
+		buf.WriteString(g.last.sep)
+	default:
+		buf.WriteString(sep)
+	}
+}
+
+// end writes the blank lines at the end of the text, after the last block
+// kept or replaced, when g is the final gap.
+func (g gap) end(buf *bytes.Buffer) {
+	switch {
+	case g.last != nil:
+		buf.WriteString(g.last.sep)
+	case g.prev != nil:
+		buf.WriteString(g.prev.sep)
+	}
+}
+
+// sepAfter returns the blank lines written after a paragraph in the style of
+// b. The last block has none, so those of the block before it are used.
+func (l *Layout) sepAfter(b *block) string {
+	n := len(l.blocks)
+	switch {
+	case b == nil:
+		return "\n"
+	case b != &l.blocks[n-1] || b.sep != "":
+		return b.sep
+	case n > 1:
+		return l.blocks[n-2].sep
+	}
+	return "\n"
+}
+
+// split splits edited lines into paragraphs, and whether each follows a
+// blank line. Lines of code, and all lines if verbatim is set, are kept as
+// they are; a list item, quote or fence starts a new paragraph, and an
+// indented line continues a list item.
+func split(lines []string, verbatim bool) ([]string, []bool) {
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if verbatim {
+		if len(lines) == 0 {
+			return nil, nil
+		}
+		return []string{strings.Join(lines, "\n")}, []bool{false}
+	}
+
+	var (
+		pars        []string
+		blankBefore []bool
+		open, item  bool
+		blankSeen   bool
+		code        string
+	)
+	add := func(s string) {
+		pars = append(pars, s)
+		blankBefore = append(blankBefore, blankSeen)
+		blankSeen = false
+	}
+	for _, l := range lines {
+		switch {
+		case code != "":
+			pars[len(pars)-1] += "\n" + l
+			if closes(l, code) {
+				code = ""
+			}
+		case l == "":
+			open, blankSeen = false, true
+		case fence(l) != "":
+			add(l)
+			open, code = false, fence(l)
+		case ListMarker(l) > 0 || quote(l):
+			add(l)
+			open, item = true, ListMarker(l) > 0
+		case open && item && preformatted(l):
+			pars[len(pars)-1] += " " + strings.TrimLeft(l, spaces)
+		case preformatted(l):
+			add(l)
+			open = false
+		case open:
+			pars[len(pars)-1] += " " + l
+		default:
+			add(l)
+			open, item = true, false
+		}
+	}
+	return pars, blankBefore
+}
+
+// hardWrap wraps a paragraph in lines no wider than width, indenting all but
+// the first.
+func hardWrap(text string, width int, indent string) string {
+	var buf bytes.Buffer
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return text + "\n"
+	}
+	line := text[:len(text)-len(strings.TrimLeft(text, spaces))] + words[0]
+	for _, w := range words[1:] {
+		if Width(line)+1+Width(w) > width {
+			buf.WriteString(line + "\n")
+			line = indent + w
+		} else {
+			line += " " + w
+		}
+	}
+	buf.WriteString(line + "\n")
+	return buf.String()
+}
+
+// indentOf returns the indent of the lines after the first of a hard-wrapped
+// paragraph, in the style of b.
+func indentOf(p string, b *block) string {
+	switch {
+	case ListMarker(p) > 0 && b.kind == Item:
+		return b.indent
+	case ListMarker(p) > 0:
+		return strings.Repeat(" ", ListMarker(p))
+	case quote(p) && b.kind == Quote:
+		return b.indent
+	case quote(p):
+		return "> "
+	}
+	return ""
+}
+
+// wrapWidth returns the width of the widest line of text outside code and
+// preformatted blocks, or 0 if the text is too narrow to be hard-wrapped.
+func wrapWidth(lines []string) int {
+	max := 0
+	code := InCode(lines)
+	for i, l := range lines {
+		if !code[i] && (!preformatted(l) || ListMarker(l) > 0) {
+			if w := Width(l); w > max {
+				max = w
+			}
+		}
+	}
+	if max < minWrap {
+		return 0
+	}
+	return max
+}
+
+// wrapped returns whether the line before next was broken because next's
+// first word would not fit on it.
+func wrapped(line, next string, width int) bool {
+	if width == 0 {
+		return false
+	}
+	word := strings.TrimLeft(next, spaces)
+	if i := strings.IndexAny(word, spaces); i >= 0 {
+		word = word[:i]
+	}
+	return Width(line)+1+Width(word) > width
+}
+
+func blank(l string) bool {
+	return strings.TrimLeft(l, spaces) == ""
+}
+
+// startsBlock returns whether l cannot continue a paragraph.
+func startsBlock(l string) bool {
+	return preformatted(l) || ListMarker(l) > 0 || quote(l) || fence(l) != ""
+}
+
+// ListMarker returns the length of the bullet or number starting l,
+// including its indent and the space after it, or 0 if l is not a list item.
+func ListMarker(l string) int {
+	s := strings.TrimLeft(l, " ")
+	n := len(l) - len(s)
+	i := 0
+	switch {
+	case s == "":
+		return 0
+	case s[0] == '-' || s[0] == '*' || s[0] == '+':
+		i = 1
+	default:
+		for i < len(s) && i < 9 && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(s) || (s[i] != '.' && s[i] != ')') {
+			return 0
+		}
+		i++
+	}
+	if i == len(s) || s[i] != ' ' {
+		return 0
+	}
+	return n + i + 1
+}
+
+// InCode returns whether each line is fenced code, including the fences.
+func InCode(lines []string) []bool {
+	res := make([]bool, len(lines))
+	code := ""
+	for i, l := range lines {
+		switch {
+		case code != "":
+			res[i] = true
+			if closes(l, code) {
+				code = ""
+			}
+		case fence(l) != "":
+			res[i] = true
+			code = fence(l)
+		}
+	}
+	return res
+}
+
+func quote(l string) bool {
+	return strings.HasPrefix(l, ">")
+}
+
+// unquote returns a quoted line without its ">" and the space after it.
+func unquote(l string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(l, ">"), " ")
+}
+
+// fence returns the fence "```" or "~~~" opening code at l, or "".
+func fence(l string) string {
+	s := strings.TrimLeft(l, " ")
+	if len(l)-len(s) > 3 {
+		return ""
+	}
+	for _, f := range []string{"```", "~~~"} {
+		if strings.HasPrefix(s, f) {
+			return f
+		}
+	}
+	return ""
+}
+
+// closes returns whether l closes code opened by fence f.
+func closes(l, f string) bool {
+	return strings.HasPrefix(strings.TrimSpace(l), f)
+}
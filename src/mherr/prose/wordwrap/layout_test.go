@@ -0,0 +1,203 @@
+package wordwrap
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestLayoutRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("testdata/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no files in testdata")
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range []int{1, 10, 40, 72, 80, 1000} {
+			for _, lists := range []bool{false, true} {
+				l := Parse(string(data))
+				l.Lists = lists
+				if got := string(l.Unfold(l.Fold(w))); got != string(data) {
+					t.Errorf("%v at width %v, lists %v: got:\n%q\nwant:\n%q", f, w, lists, got, data)
+				}
+			}
+		}
+	}
+}
+
+func TestLayoutRoundTripRandom(t *testing.T) {
+	const alphabet = "ab  \n\n\t->*1.)`~ \r日"
+	f := func(b []byte, w uint8) bool {
+		var s strings.Builder
+		for _, c := range b {
+			s.WriteString(string([]rune(alphabet)[int(c)%len([]rune(alphabet))]))
+		}
+		l := Parse(s.String())
+		l.Lists = w%2 == 0
+		return string(l.Unfold(l.Fold(int(w)%50+1))) == s.String()
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLayoutFold(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		width int
+		want  []string
+	}{
+		{
+			"hard-wrapped paragraph",
+			"the quick brown fox jumped over the lazy dog and\nthen ran away.\n",
+			100,
+			[]string{"the quick brown fox jumped over the lazy dog and then ran away."},
+		},
+		{
+			"short lines are kept",
+			"the quick brown\nfox.\n",
+			100,
+			[]string{"the quick brown", "", "fox."},
+		},
+		{
+			"list items",
+			"- the quick brown fox jumped over the lazy dog and\n  then ran away.\n- 2\n1. one\n",
+			100,
+			[]string{"- the quick brown fox jumped over the lazy dog and then ran away.", "", "- 2", "", "1. one"},
+		},
+		{
+			"block quote",
+			"> the quick brown fox jumped over the lazy dog and\n> then ran away.\n",
+			100,
+			[]string{"> the quick brown fox jumped over the lazy dog and then ran away."},
+		},
+		{
+			"fenced code",
+			"```\nthe quick brown fox jumped over the lazy dog and\nthen\n\nran\n```\ntext\n",
+			100,
+			[]string{"```", "the quick brown fox jumped over the lazy dog and", "then", "", "ran", "```", "", "text"},
+		},
+		{
+			"preformatted",
+			"  one\n  two\nthree\n",
+			100,
+			[]string{"  one", "  two", "", "three"},
+		},
+		{
+			"indented list item",
+			"  - one two three\n",
+			10,
+			[]string{"  - one", "two three"},
+		},
+	}
+
+	for _, c := range tests {
+		got := Parse(c.input).Fold(c.width)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("test(%v): got:\n%#v\nwant:\n%#v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestLayoutEdit(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		edit  func([]string) []string
+		want  string
+	}{
+		{
+			"edited paragraph is rewrapped",
+			"the quick brown fox jumped over the lazy dog and\nthen ran away.\n\nA second paragraph,  which is not\nedited.\n",
+			func(l []string) []string {
+				l[0] = "a quick brown fox jumped over the lazy dog and then ran away, far away into the woods."
+				return l
+			},
+			"a quick brown fox jumped over the lazy dog and\nthen ran away, far away into the woods.\n\nA second paragraph,  which is not\nedited.\n",
+		},
+		{
+			"edited list item keeps its indent",
+			"- eggs\n- the quick brown fox jumped over the lazy dog and\n    then ran away.\n- milk\n",
+			func(l []string) []string {
+				l[2] = "- the quick brown fox jumped over the lazy cat and then ran away."
+				return l
+			},
+			"- eggs\n- the quick brown fox jumped over the lazy cat and\n    then ran away.\n- milk\n",
+		},
+		{
+			"new list item",
+			"- eggs\n- milk\n",
+			func(l []string) []string {
+				return []string{l[0], "", "- flour", "", l[2]}
+			},
+			"- eggs\n- flour\n- milk\n",
+		},
+		{
+			"new paragraph at the end",
+			"one\n\ntwo",
+			func(l []string) []string {
+				return append(l, "", "three")
+			},
+			"one\n\ntwo\n\nthree",
+		},
+		{
+			"edited code",
+			"text\n\n```\nfoo\nbar\n```\n",
+			func(l []string) []string {
+				l[4] = "baz"
+				return l
+			},
+			"text\n\n```\nfoo\nbaz\n```\n",
+		},
+		{
+			"deleted paragraph",
+			"one\n\ntwo\n\nthree\n",
+			func(l []string) []string {
+				return append(l[:2], l[4:]...)
+			},
+			"one\n\nthree\n",
+		},
+	}
+
+	for _, c := range tests {
+		l := Parse(c.input)
+		got := string(l.Unfold(c.edit(l.Fold(100))))
+		if got != c.want {
+			t.Errorf("test(%v): got:\n%q\nwant:\n%q", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestLayoutLists(t *testing.T) {
+	input := "- the quick brown fox jumped over the lazy dog and\n  then ran away.\n- milk\n\n1. one\n"
+	l := Parse(input)
+	l.Lists = true
+	got := l.Fold(30)
+	want := []string{
+		"- the quick brown fox jumped",
+		"  over the lazy dog and then",
+		"  ran away.",
+		"- milk",
+		"",
+		"1. one",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got:\n%#v\nwant:\n%#v", got, want)
+	}
+
+	got[5] = "1. one two"
+	got = append(got[:4], append([]string{"- eggs", "  and ham"}, got[4:]...)...)
+	if got, want := string(l.Unfold(got)), "- the quick brown fox jumped over the lazy dog and\n  then ran away.\n- milk\n- eggs and ham\n\n1. one two\n"; got != want {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
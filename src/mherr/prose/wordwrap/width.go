@@ -0,0 +1,161 @@
+package wordwrap
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// wide contains the ranges of East Asian wide and fullwidth characters, which
+// occupy two columns in the terminal.
+var wide = []struct{ lo, hi rune }{
+	{0x1100, 0x115f},
+	{0x231a, 0x231b},
+	{0x2329, 0x232a},
+	{0x23e9, 0x23ec},
+	{0x23f0, 0x23f0},
+	{0x23f3, 0x23f3},
+	{0x25fd, 0x25fe},
+	{0x2614, 0x2615},
+	{0x2648, 0x2653},
+	{0x267f, 0x267f},
+	{0x2693, 0x2693},
+	{0x26a1, 0x26a1},
+	{0x26aa, 0x26ab},
+	{0x26bd, 0x26be},
+	{0x26c4, 0x26c5},
+	{0x26ce, 0x26ce},
+	{0x26d4, 0x26d4},
+	{0x26ea, 0x26ea},
+	{0x26f2, 0x26f3},
+	{0x26f5, 0x26f5},
+	{0x26fa, 0x26fa},
+	{0x26fd, 0x26fd},
+	{0x2705, 0x2705},
+	{0x270a, 0x270b},
+	{0x2728, 0x2728},
+	{0x274c, 0x274c},
+	{0x274e, 0x274e},
+	{0x2753, 0x2755},
+	{0x2757, 0x2757},
+	{0x2795, 0x2797},
+	{0x27b0, 0x27b0},
+	{0x27bf, 0x27bf},
+	{0x2b1b, 0x2b1c},
+	{0x2b50, 0x2b50},
+	{0x2b55, 0x2b55},
+	{0x2e80, 0x303e},
+	{0x3041, 0x33ff},
+	{0x3400, 0x4dbf},
+	{0x4e00, 0x9fff},
+	{0xa000, 0xa4cf},
+	{0xa960, 0xa97f},
+	{0xac00, 0xd7a3},
+	{0xf900, 0xfaff},
+	{0xfe10, 0xfe19},
+	{0xfe30, 0xfe6f},
+	{0xff00, 0xff60},
+	{0xffe0, 0xffe6},
+	{0x16fe0, 0x16fe4},
+	{0x17000, 0x18aff},
+	{0x1b000, 0x1b2ff},
+	{0x1f004, 0x1f004},
+	{0x1f0cf, 0x1f0cf},
+	{0x1f18e, 0x1f18e},
+	{0x1f191, 0x1f19a},
+	{0x1f200, 0x1f251},
+	{0x1f300, 0x1f64f},
+	{0x1f680, 0x1f6ff},
+	{0x1f7e0, 0x1f7eb},
+	{0x1f90c, 0x1f9ff},
+	{0x1fa70, 0x1faff},
+	{0x20000, 0x2fffd},
+	{0x30000, 0x3fffd},
+}
+
+// RuneWidth returns the number of terminal columns used to display r.
+// Combining marks and other zero-width characters return 0.
+func RuneWidth(r rune) int {
+	switch {
+	case r == 0:
+		return 0
+	case r < 0x300:
+		return 1
+	case r >= 0x1160 && r <= 0x11ff: // Hangul medial vowels and final consonants.
+		return 0
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	}
+
+	// Binary search the table of wide characters.
+	lo, hi := 0, len(wide)
+	for lo < hi {
+		m := (lo + hi) / 2
+		switch {
+		case r < wide[m].lo:
+			hi = m
+		case r > wide[m].hi:
+			lo = m + 1
+		default:
+			return 2
+		}
+	}
+	return 1
+}
+
+// Width returns the number of terminal columns used to display s.
+func Width(s string) int {
+	w := 0
+	for _, r := range s {
+		w += RuneWidth(r)
+	}
+	return w
+}
+
+// Offset returns the length in bytes of the longest prefix of s which fits
+// within col columns. Zero-width characters such as combining marks are kept
+// with the character they follow.
+func Offset(s string, col int) int {
+	w := 0
+	for i, r := range s {
+		rw := RuneWidth(r)
+		if rw > 0 && w+rw > col {
+			return i
+		}
+		w += rw
+	}
+	return len(s)
+}
+
+// NextBoundary returns the byte offset of the character after the one
+// starting at i, skipping any combining marks which follow it.
+func NextBoundary(s string, i int) int {
+	if i >= len(s) {
+		return len(s)
+	}
+	_, n := utf8.DecodeRuneInString(s[i:])
+	i += n
+	for i < len(s) {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if RuneWidth(r) != 0 {
+			break
+		}
+		i += n
+	}
+	return i
+}
+
+// PrevBoundary returns the byte offset of the character before i, including
+// any combining marks which follow it.
+func PrevBoundary(s string, i int) int {
+	if i > len(s) {
+		i = len(s)
+	}
+	for i > 0 {
+		r, n := utf8.DecodeLastRuneInString(s[:i])
+		i -= n
+		if RuneWidth(r) != 0 {
+			break
+		}
+	}
+	return i
+}
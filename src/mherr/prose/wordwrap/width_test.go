@@ -0,0 +1,67 @@
+package wordwrap
+
+import "testing"
+
+func TestWidth(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"", 0},
+		{"hello", 5},
+		{"naïve", 5},
+		{"e\u0301", 1},
+		{"em—dash", 7},
+		{"“quoted”", 8},
+		{"日本", 4},
+		{"ｈｉ", 4},
+		{"\u200d", 0},
+	}
+
+	for _, c := range tests {
+		if got := Width(c.input); got != c.want {
+			t.Fatalf("Width(%q): got %v, want %v", c.input, got, c.want)
+		}
+	}
+}
+
+func TestOffset(t *testing.T) {
+	tests := []struct {
+		input string
+		col   int
+		want  int
+	}{
+		{"hello", 0, 0},
+		{"hello", 3, 3},
+		{"hello", 9, 5},
+		{"日本語", 3, 3},
+		{"日本語", 4, 6},
+		{"e\u0301x", 1, 3},
+		{"e\u0301x", 0, 0},
+	}
+
+	for _, c := range tests {
+		if got := Offset(c.input, c.col); got != c.want {
+			t.Fatalf("Offset(%q, %v): got %v, want %v", c.input, c.col, got, c.want)
+		}
+	}
+}
+
+func TestBoundary(t *testing.T) {
+	s := "ae\u0301日x"
+	next := []int{1, 4, 7, 8}
+	i := 0
+	for _, want := range next {
+		i = NextBoundary(s, i)
+		if i != want {
+			t.Fatalf("NextBoundary: got %v, want %v", i, want)
+		}
+	}
+	prev := []int{7, 4, 1, 0}
+	for _, want := range prev {
+		i = PrevBoundary(s, i)
+		if i != want {
+			t.Fatalf("PrevBoundary: got %v, want %v", i, want)
+		}
+	}
+}
@@ -17,11 +17,12 @@ const (
 
 const spaces = " \t"
 
-// Fold breaks the input into paragraphs with lines no longer than lim runes.
+// Fold breaks the input into paragraphs with lines no wider than lim columns.
 func Fold(inp string, lim int) []string {
 	var res []string
 	var line bytes.Buffer
 	lastSpace := 0
+	width := 0
 	inPar := false
 	lastPre := false
 
@@ -39,26 +40,30 @@ func Fold(inp string, lim int) []string {
 		inPar = false
 		line.Reset()
 		lastSpace = 0
+		width = 0
 	}
 
 	for _, c := range inp {
 		if !inPar {
 			if c != '\n' {
 				line.WriteRune(c)
+				width += RuneWidth(c)
 				inPar = true
 			}
 		} else {
 			switch {
 			case c == ' ':
 				line.WriteRune(c)
+				width++
 				lastSpace = line.Len()
 			case c == '\n':
 				emit(true)
 			default:
 				line.WriteRune(c)
+				width += RuneWidth(c)
 			}
 
-			if line.Len() > lim {
+			if width > lim {
 				if lastSpace == 0 {
 					lastSpace = line.Len()
 				}
@@ -72,6 +77,7 @@ func Fold(inp string, lim int) []string {
 				line.Reset()
 				line.WriteString(tail)
 				lastSpace = 0
+				width = Width(tail)
 			}
 		}
 	}
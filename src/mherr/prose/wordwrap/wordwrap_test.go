@@ -116,3 +116,34 @@ func TestUnfold(t *testing.T) {
 		}
 	}
 }
+
+func TestFoldWide(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		want  []string
+	}{
+		{
+			"accented characters count as one column",
+			"café crème brûlée",
+			[]string{"café crème", "brûlée"},
+		},
+		{
+			"combining marks take no space",
+			"cafe\u0301 cre\u0300me",
+			[]string{"cafe\u0301 cre\u0300me"},
+		},
+		{
+			"wide characters count as two columns",
+			"日本語 日本語の",
+			[]string{"日本語", "日本語の"},
+		},
+	}
+
+	for _, c := range tests {
+		got := Fold(c.input, 10)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("test(%v): got:\n%#v\nwant:\n%#v", c.desc, got, c.want)
+		}
+	}
+}